@@ -3,44 +3,62 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/config"
 	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+	"github.com/alexandrecpedro/ama-room/backend/internal/tracing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
-	// (1) Load .env variables
-	if err := godotenv.Load(); err != nil {
-		// panic(err)
-		panic(fmt.Sprintf("Error while loading .env: %v", err))
+	// (1) Load the configuration: flags > environment > .env (optional) > defaults
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
+	if err != nil {
+		panic(fmt.Sprintf("Invalid configuration:\n%v", err))
+	}
+	cfg.Print(os.Stdout)
 
 	// (2) DB connection
 	// context
-	ctx := context.Background()
+	// Ps: canceled on shutdown, after the subscribers are gone (stops the broadcaster)
+	ctx, stopBroadcaster := context.WithCancel(context.Background())
+	defer stopBroadcaster()
+
+	// Tracing: none (default) | stdout | otlp (see OTEL_EXPORTER_OTLP_ENDPOINT)
+	// Ps: installed before the pool, so queries are traced from the first one
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracingExporter)
+	if err != nil {
+		panic(fmt.Sprintf("Error while setting up tracing: %v", err))
+	}
 
 	// connection pool (pgx manage connections)
-	pool, err := pgxpool.New(ctx, fmt.Sprintf(
-		"user=%s password=%s host=%s port=%s dbname=%s",
-		os.Getenv("WSRS_DATABASE_USER"),
-		os.Getenv("WSRS_DATABASE_PASSWORD"),
-		os.Getenv("WSRS_DATABASE_HOST"),
-		os.Getenv("WSRS_DATABASE_PORT"),
-		os.Getenv("WSRS_DATABASE_NAME"),
-	))
+	poolConfig, err := cfg.Database.PoolConfig()
+	if err != nil {
+		panic(fmt.Sprintf("Error while connecting to db: %v", err))
+	}
+	// one span per query
+	poolConfig.ConnConfig.Tracer = pgstore.NewQueryTracer(otel.GetTracerProvider())
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		panic(fmt.Sprintf("Error while connecting to db: %v", err))
 	}
 
 	// (3) Before function return, execute the code described with defer
 	// similar to make a clean-up
+	// Ps: runs when main returns, after the shutdown below
 	defer pool.Close()
 
 	if err := pool.Ping(ctx); err != nil {
@@ -48,18 +66,20 @@ func main() {
 	}
 
 	// pgstore.New(DB_CONNECTION) => method created by sqlc
-	handler := api.NewHandler(pgstore.New(pool))
+	handler := api.NewHandler(pgstore.New(pool), handlerOptions(ctx, cfg, pool)...)
 
 	// (4) Async start http server
 	// http server is blocking - runs infinitely until the server runs into error
+	// Ps: no read/write timeouts, websocket connections last for hours (they have their own deadlines)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
 	go func() {
-		port := os.Getenv("SERVER_PORT")
-		if port == "" {
-			port = "8080"
-		}
-		serverPort := fmt.Sprintf(":%s", port)
-		fmt.Println("Server running on port", port)
-		err := http.ListenAndServe(serverPort, handler)
+		fmt.Println("Server running on port", cfg.Server.Port)
+		err := server.ListenAndServe()
 		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				panic(fmt.Sprintf("Error while starting server: %v", err))
@@ -68,9 +88,117 @@ func main() {
 
 	}()
 
-	// (5) Quit when receives interrupt signal from Operational System
+	// (5) Quit when receives interrupt (Ctrl+C) or terminate (Kubernetes, Docker) signal from Operational System
 	// os.Signal must be buffered
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+
+	// (6) Graceful shutdown, within WSRS_SHUTDOWN_TIMEOUT (default 25s, below the 30s Kubernetes grace period)
+	// i. Websockets: queued events + close 1001 to every subscriber (/readyz fails from now on)
+	// ii. HTTP, after WSRS_SHUTDOWN_DELAY (default 0s, so load balancers see /readyz failing first):
+	// stop accepting connections and wait for in-flight requests
+	// iii. Then the broadcaster, the pending spans, and the pool last (deferred above)
+	fmt.Println("Shutting down, draining connections for up to", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+
+	handlerDone := make(chan error, 1)
+	go func() { handlerDone <- handler.Shutdown(shutdownCtx) }()
+	// Ps: the delay counts towards the timeout
+	select {
+	case <-time.After(cfg.Server.ShutdownDelay):
+	case <-shutdownCtx.Done():
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("HTTP requests not drained:", err)
+	}
+	if err := <-handlerDone; err != nil {
+		fmt.Println("Websocket subscribers not drained:", err)
+	}
+
+	stopBroadcaster()
+
+	// Ps: own deadline, the spans of a slow drain are the interesting ones
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		fmt.Println("Spans not flushed:", err)
+	}
+}
+
+// handlerOptions: api options of the configuration
+func handlerOptions(ctx context.Context, cfg *config.Config, pool *pgxpool.Pool) []api.Option {
+	opts := []api.Option{api.WithAllowedOrigins(cfg.Server.CORSOrigins)}
+
+	// Room events broadcaster
+	// postgres fans events out to every replica via LISTEN/NOTIFY
+	// Ps: default = in-process (single instance)
+	if cfg.Server.Broadcaster == "postgres" {
+		opts = append(opts, api.WithBroadcaster(api.NewPGBroadcaster(ctx, pool)))
+	}
+
+	// Websocket subscribers: send queue, overflow policy, write timeout and keepalive
+	overflowPolicy := api.OverflowDropOldest
+	if cfg.Websocket.OverflowPolicy == "disconnect" {
+		overflowPolicy = api.OverflowDisconnect
+	}
+	opts = append(opts,
+		api.WithSendQueue(cfg.Websocket.SendQueueSize, overflowPolicy),
+		api.WithWriteTimeout(cfg.Websocket.WriteTimeout),
+		api.WithKeepalive(cfg.Websocket.PingInterval, cfg.Websocket.PongTimeout),
+	)
+
+	// Participant tokens are signed with the participant secret (HMAC-SHA256)
+	if cfg.ParticipantSecret != "" {
+		opts = append(opts, api.WithParticipantSecret([]byte(cfg.ParticipantSecret)))
+	}
+
+	// Content filters for participant text (questions and replies)
+	filters := []api.MessageFilter{api.NewMaxLengthFilter(cfg.Filters.MaxLength)}
+	if len(cfg.Filters.BlockedWords) > 0 {
+		filters = append(filters, api.NewWordListFilter(cfg.Filters.BlockedWords, api.FilterReject))
+	}
+	if len(cfg.Filters.FlaggedWords) > 0 {
+		filters = append(filters, api.NewWordListFilter(cfg.Filters.FlaggedWords, api.FilterFlag))
+	}
+	for _, rule := range []api.RegexRule{
+		{Pattern: cfg.Filters.BlockedPattern, Verdict: api.FilterReject, Reason: "Message is not allowed!"},
+		{Pattern: cfg.Filters.FlaggedPattern, Verdict: api.FilterFlag, Reason: "Message is not allowed!"},
+	} {
+		if rule.Pattern != nil {
+			filters = append(filters, api.NewRegexFilter(rule))
+		}
+	}
+	switch cfg.Filters.Links {
+	case "flag":
+		filters = append(filters, api.NewLinkFilter(api.FilterFlag))
+	case "reject":
+		filters = append(filters, api.NewLinkFilter(api.FilterReject))
+	}
+	opts = append(opts, api.WithMessageFilters(filters...))
+
+	// Client IP and rate limits per route class
+	rateLimits := make(map[string]api.RateLimit)
+	for class, limit := range map[string]config.RateLimit{
+		api.RateClassParticipants: cfg.RateLimits.Participants,
+		api.RateClassRooms:        cfg.RateLimits.Rooms,
+		api.RateClassMessages:     cfg.RateLimits.Messages,
+		api.RateClassReactions:    cfg.RateLimits.Reactions,
+	} {
+		if limit.Count > 0 {
+			rateLimits[class] = api.NewRateLimit(limit.Count, limit.Period)
+		}
+	}
+	opts = append(opts, api.WithTrustedProxies(cfg.TrustedProxies), api.WithRateLimits(rateLimits))
+
+	// Metrics (GET /metrics): handler metrics + connection pool statistics
+	registry := api.NewMetricsRegistry()
+	registry.MustRegister(api.NewPoolCollector(pool))
+	opts = append(opts, api.WithMetricsRegistry(registry))
+
+	// Readiness (GET /readyz): database reachable and migrated at least to the version of this binary
+	opts = append(opts, api.WithReadinessChecks(api.NewDatabaseCheck(pool), api.NewMigrationsCheck(pool)))
+
+	return opts
 }
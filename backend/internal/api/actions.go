@@ -0,0 +1,545 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ROOM ACTIONS
+// Ps1: shared by the REST handlers and the websocket commands, so both paths
+// run the same store logic and emit identical events
+// Ps2: internal failures are logged here and reported as ErrSomethingWentWrong
+// Ps3: events are recorded before the action returns, so their sequence follows the order
+// of the actions and the caller (REST response or command_ack) never gets ahead of them
+
+// (a) CREATE MESSAGE
+// Ps1: on moderated rooms, messages from participants wait for the host approval (pending)
+// and message_created is only broadcast once approved (see moderateMessage)
+// Ps2: messages flagged by a filter wait for the approval too, whatever the room setting
+func (apiHandler apiHandler) createMessage(ctx context.Context, roomID uuid.UUID, text string) (CommandCreateMessageResult, error) {
+	room, err := apiHandler.requireOpenRoom(ctx, roomID)
+	if err != nil {
+		return CommandCreateMessageResult{}, err
+	}
+
+	filtered := apiHandler.filterMessage(ctx, text)
+	if filtered.Verdict == FilterReject {
+		return CommandCreateMessageResult{}, rejectedMessage(filtered)
+	}
+
+	status := MessageStatusApproved
+	if filtered.Verdict == FilterFlag || (room.Moderated && !isHost(ctx, room)) {
+		status = MessageStatusPending
+	}
+
+	messageID, err := apiHandler.query.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: roomID, Message: text, Status: status})
+	if err != nil {
+		slog.Error(LogFailedToInsertMessage, "error", err)
+		return CommandCreateMessageResult{}, ErrSomethingWentWrong
+	}
+
+	if status == MessageStatusApproved {
+		apiHandler.broadcastMessageCreated(ctx, roomID, messageID, text)
+	}
+
+	return CommandCreateMessageResult{ID: messageID.String(), Status: status, Reason: filtered.Reason}, nil
+}
+
+// (a.1) BROADCAST MESSAGE CREATED
+// Notify all clients
+func (apiHandler apiHandler) broadcastMessageCreated(ctx context.Context, roomID, messageID uuid.UUID, text string) {
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindMessageCreated,
+		RoomID: roomID.String(),
+		Value: MessageMessageCreated{
+			ID:      messageID.String(),
+			Message: text,
+		},
+	})
+}
+
+// (b) MARK MESSAGE AS ANSWERED (host only)
+func (apiHandler apiHandler) markMessageAsAnswered(ctx context.Context, roomID, messageID uuid.UUID) error {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return err
+	}
+
+	if _, err := apiHandler.readRoomMessage(ctx, roomID, messageID); err != nil {
+		return err
+	}
+
+	if err := apiHandler.query.MarkMessageAsAnswered(ctx, messageID); err != nil {
+		slog.Error(LogFailedToMarkAsAnswered, "error", err)
+		return ErrSomethingWentWrong
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindMessageAnswered,
+		RoomID: roomID.String(),
+		Value: MessageMessageAnswered{
+			ID: messageID.String(),
+		},
+	})
+
+	return nil
+}
+
+// (c) REACT TO MESSAGE
+// Ps: idempotent; a participant counts once per message
+func (apiHandler apiHandler) reactToMessage(ctx context.Context, roomID, messageID uuid.UUID) (int64, error) {
+	// Ps: reactions are kept per participant
+	participantID, ok := participantFromContext(ctx)
+	if !ok {
+		return 0, ErrParticipantMissing
+	}
+
+	if _, err := apiHandler.requireOpenRoom(ctx, roomID); err != nil {
+		return 0, err
+	}
+
+	if _, err := apiHandler.readRoomMessage(ctx, roomID, messageID); err != nil {
+		return 0, err
+	}
+
+	row, err := apiHandler.query.ReactToMessage(ctx, pgstore.ReactToMessageParams{MessageID: messageID, ParticipantID: participantID})
+	if err != nil {
+		slog.Error(LogFailedToReactToMessage, "error", err)
+		return 0, ErrSomethingWentWrong
+	}
+
+	// Ps: a repeated call changes nothing, so there is no event (and no sequence number) for it
+	if row.Changed {
+		apiHandler.broadcast(ctx, Message{
+			Kind:   MessageKindMessageReactionIncreased,
+			RoomID: roomID.String(),
+			Value: MessageMessageReactionIncreased{
+				ID:    messageID.String(),
+				Count: row.ReactionCount,
+			},
+		})
+	}
+
+	return row.ReactionCount, nil
+}
+
+// (d) REMOVE REACTION FROM MESSAGE
+// Ps: idempotent; removing a reaction that does not exist changes nothing
+func (apiHandler apiHandler) removeReactionFromMessage(ctx context.Context, roomID, messageID uuid.UUID) (int64, error) {
+	// Ps: reactions are kept per participant
+	participantID, ok := participantFromContext(ctx)
+	if !ok {
+		return 0, ErrParticipantMissing
+	}
+
+	if _, err := apiHandler.requireOpenRoom(ctx, roomID); err != nil {
+		return 0, err
+	}
+
+	if _, err := apiHandler.readRoomMessage(ctx, roomID, messageID); err != nil {
+		return 0, err
+	}
+
+	row, err := apiHandler.query.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{MessageID: messageID, ParticipantID: participantID})
+	if err != nil {
+		slog.Error(LogFailedToRemoveReaction, "error", err)
+		return 0, ErrSomethingWentWrong
+	}
+
+	// Ps: a repeated call changes nothing, so there is no event (and no sequence number) for it
+	if row.Changed {
+		apiHandler.broadcast(ctx, Message{
+			Kind:   MessageKindMessageReactionDecreased,
+			RoomID: roomID.String(),
+			Value: MessageMessageReactionDecreased{
+				ID:    messageID.String(),
+				Count: row.ReactionCount,
+			},
+		})
+	}
+
+	return row.ReactionCount, nil
+}
+
+// (b.1) DELETE MESSAGE (host only)
+// Ps: pending and rejected messages can be deleted too (participants never saw them: no event)
+func (apiHandler apiHandler) deleteMessage(ctx context.Context, roomID, messageID uuid.UUID) error {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return err
+	}
+
+	message, err := apiHandler.readAnyRoomMessage(ctx, roomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if err := apiHandler.query.DeleteMessage(ctx, messageID); err != nil {
+		slog.Error(LogFailedToDeleteMessage, "error", err)
+		return ErrSomethingWentWrong
+	}
+
+	if message.Status != MessageStatusApproved {
+		return nil
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindMessageDeleted,
+		RoomID: roomID.String(),
+		Value: MessageMessageDeleted{
+			ID: messageID.String(),
+		},
+	})
+
+	return nil
+}
+
+// (e) READ ROOM MESSAGE
+// Get an approved message, making sure it belongs to roomID
+// Ps: pending and rejected messages do not exist for participants (ErrMessageNotFound)
+func (apiHandler apiHandler) readRoomMessage(ctx context.Context, roomID, messageID uuid.UUID) (pgstore.Message, error) {
+	message, err := apiHandler.readAnyRoomMessage(ctx, roomID, messageID)
+	if err != nil {
+		return pgstore.Message{}, err
+	}
+
+	if message.Status != MessageStatusApproved {
+		return pgstore.Message{}, ErrMessageNotFound
+	}
+
+	return message, nil
+}
+
+// (e.1) READ ANY ROOM MESSAGE
+// Same as readRoomMessage, whatever the moderation status (host views)
+func (apiHandler apiHandler) readAnyRoomMessage(ctx context.Context, roomID, messageID uuid.UUID) (pgstore.Message, error) {
+	message, err := apiHandler.query.GetMessage(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Message{}, ErrMessageNotFound
+		}
+
+		slog.Error(LogFailedToGetRoomMessage, "error", err)
+		return pgstore.Message{}, ErrSomethingWentWrong
+	}
+
+	if message.RoomID != roomID {
+		return pgstore.Message{}, ErrMessageNotFound
+	}
+
+	return message, nil
+}
+
+// (f) CHANGE ROOM STATUS (host only)
+// open <-> closed, open | closed -> archived
+// Ps: setting the current status again changes nothing (no event)
+func (apiHandler apiHandler) changeRoomStatus(ctx context.Context, roomID uuid.UUID, status string) (pgstore.Room, error) {
+	room, err := apiHandler.requireHost(ctx, roomID)
+	if err != nil {
+		return pgstore.Room{}, err
+	}
+
+	if room.Status == status {
+		return room, nil
+	}
+
+	room, err = apiHandler.query.UpdateRoomStatus(ctx, pgstore.UpdateRoomStatusParams{Status: status, ID: roomID})
+	if err != nil {
+		slog.Error(LogFailedToUpdateRoomStatus, "error", err)
+		return pgstore.Room{}, ErrSomethingWentWrong
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindRoomStatusChanged,
+		RoomID: roomID.String(),
+		Value: MessageRoomStatusChanged{
+			Status: status,
+		},
+	})
+
+	return room, nil
+}
+
+// (g) REQUIRE OPEN ROOM
+// Questions and reactions are only accepted while the room is open
+func (apiHandler apiHandler) requireOpenRoom(ctx context.Context, roomID uuid.UUID) (pgstore.Room, error) {
+	room, err := apiHandler.query.GetRoom(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Room{}, ErrRoomNotFound
+		}
+
+		slog.Error(LogFailedToGetRoom, "error", err)
+		return pgstore.Room{}, ErrSomethingWentWrong
+	}
+
+	switch room.Status {
+	case RoomStatusClosed:
+		return pgstore.Room{}, ErrRoomClosed
+	case RoomStatusArchived:
+		return pgstore.Room{}, ErrRoomArchived
+	}
+
+	return room, nil
+}
+
+// maxAnswerLength: answers.answer is VARCHAR(1000)
+// Ps: keeps answer events below the pg_notify payload limit (8000 bytes), even fully escaped
+const maxAnswerLength = 1000
+
+// validAnswer: not empty and at most maxAnswerLength characters (like VARCHAR(n))
+func validAnswer(text string) bool {
+	return text != "" && utf8.RuneCountInString(text) <= maxAnswerLength
+}
+
+// (h) CREATE ANSWER (host only)
+// Ps: answering a question also marks it as answered
+func (apiHandler apiHandler) createAnswer(ctx context.Context, roomID, messageID uuid.UUID, text string) (pgstore.Answer, error) {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return pgstore.Answer{}, err
+	}
+
+	text = strings.TrimSpace(text)
+	if !validAnswer(text) {
+		return pgstore.Answer{}, ErrInvalidAnswer
+	}
+
+	message, err := apiHandler.readRoomMessage(ctx, roomID, messageID)
+	if err != nil {
+		return pgstore.Answer{}, err
+	}
+
+	answer, err := apiHandler.query.InsertAnswer(ctx, pgstore.InsertAnswerParams{MessageID: messageID, Answer: text})
+	if err != nil {
+		slog.Error(LogFailedToInsertAnswer, "error", err)
+		return pgstore.Answer{}, ErrSomethingWentWrong
+	}
+
+	// Ps: marking it answered is best effort, the answer is there anyway
+	markedAnswered := false
+	if !message.Answered {
+		if err := apiHandler.query.MarkMessageAsAnswered(ctx, messageID); err != nil {
+			slog.Error(LogFailedToMarkAsAnswered, "error", err)
+		} else {
+			markedAnswered = true
+		}
+	}
+
+	// Notify all clients (answer first)
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindAnswerCreated,
+		RoomID: roomID.String(),
+		Value:  MessageAnswerCreated(newAnswerResponse(answer)),
+	})
+	if markedAnswered {
+		apiHandler.broadcast(ctx, Message{
+			Kind:   MessageKindMessageAnswered,
+			RoomID: roomID.String(),
+			Value: MessageMessageAnswered{
+				ID: messageID.String(),
+			},
+		})
+	}
+
+	return answer, nil
+}
+
+// (i) UPDATE ANSWER (host only)
+func (apiHandler apiHandler) updateAnswer(ctx context.Context, roomID, messageID, answerID uuid.UUID, text string) (pgstore.Answer, error) {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return pgstore.Answer{}, err
+	}
+
+	text = strings.TrimSpace(text)
+	if !validAnswer(text) {
+		return pgstore.Answer{}, ErrInvalidAnswer
+	}
+
+	if _, err := apiHandler.readMessageAnswer(ctx, roomID, messageID, answerID); err != nil {
+		return pgstore.Answer{}, err
+	}
+
+	answer, err := apiHandler.query.UpdateAnswer(ctx, pgstore.UpdateAnswerParams{Answer: text, ID: answerID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Answer{}, ErrAnswerNotFound
+		}
+
+		slog.Error(LogFailedToUpdateAnswer, "error", err)
+		return pgstore.Answer{}, ErrSomethingWentWrong
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindAnswerUpdated,
+		RoomID: roomID.String(),
+		Value:  MessageAnswerUpdated(newAnswerResponse(answer)),
+	})
+
+	return answer, nil
+}
+
+// (j) DELETE ANSWER (host only)
+// Ps: the message stays answered
+func (apiHandler apiHandler) deleteAnswer(ctx context.Context, roomID, messageID, answerID uuid.UUID) error {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return err
+	}
+
+	if _, err := apiHandler.readMessageAnswer(ctx, roomID, messageID, answerID); err != nil {
+		return err
+	}
+
+	if err := apiHandler.query.DeleteAnswer(ctx, answerID); err != nil {
+		slog.Error(LogFailedToDeleteAnswer, "error", err)
+		return ErrSomethingWentWrong
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindAnswerDeleted,
+		RoomID: roomID.String(),
+		Value: MessageAnswerDeleted{
+			ID:        answerID.String(),
+			MessageID: messageID.String(),
+		},
+	})
+
+	return nil
+}
+
+// (k) READ MESSAGE ANSWER
+// Get an answer, making sure it belongs to messageID (and messageID to roomID)
+func (apiHandler apiHandler) readMessageAnswer(ctx context.Context, roomID, messageID, answerID uuid.UUID) (pgstore.Answer, error) {
+	if _, err := apiHandler.readRoomMessage(ctx, roomID, messageID); err != nil {
+		return pgstore.Answer{}, err
+	}
+
+	answer, err := apiHandler.query.GetAnswer(ctx, answerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Answer{}, ErrAnswerNotFound
+		}
+
+		slog.Error(LogFailedToGetAnswers, "error", err)
+		return pgstore.Answer{}, ErrSomethingWentWrong
+	}
+
+	if answer.MessageID != messageID {
+		return pgstore.Answer{}, ErrAnswerNotFound
+	}
+
+	return answer, nil
+}
+
+// (l) CREATE REPLY
+// Follow-up on an existing message; only accepted while the room is open
+func (apiHandler apiHandler) createReply(ctx context.Context, roomID, messageID uuid.UUID, text string) (pgstore.Reply, error) {
+	if _, err := apiHandler.requireOpenRoom(ctx, roomID); err != nil {
+		return pgstore.Reply{}, err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return pgstore.Reply{}, ErrInvalidReply
+	}
+
+	// Ps: replies have no moderation queue, flagged ones are rejected
+	if filtered := apiHandler.filterMessage(ctx, text); filtered.Verdict != FilterAllow {
+		return pgstore.Reply{}, rejectedMessage(filtered)
+	}
+
+	if _, err := apiHandler.readRoomMessage(ctx, roomID, messageID); err != nil {
+		return pgstore.Reply{}, err
+	}
+
+	row, err := apiHandler.query.InsertReply(ctx, pgstore.InsertReplyParams{MessageID: messageID, Reply: text})
+	if err != nil {
+		// the message was deleted in between
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Reply{}, ErrMessageNotFound
+		}
+
+		slog.Error(LogFailedToInsertReply, "error", err)
+		return pgstore.Reply{}, ErrSomethingWentWrong
+	}
+
+	reply := pgstore.Reply{ID: row.ID, MessageID: row.MessageID, Reply: row.Reply, CreatedAt: row.CreatedAt}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindMessageReplyCreated,
+		RoomID: roomID.String(),
+		Value: MessageMessageReplyCreated{
+			replyResponse: newReplyResponse(reply),
+			ReplyCount:    row.ReplyCount,
+		},
+	})
+
+	return reply, nil
+}
+
+// (m) SET ROOM MODERATION (host only)
+// Ps1: turning it off does not approve the pending messages (the host still decides)
+// Ps2: setting the current value again changes nothing (no event)
+func (apiHandler apiHandler) setRoomModeration(ctx context.Context, roomID uuid.UUID, moderated bool) (pgstore.Room, error) {
+	room, err := apiHandler.requireHost(ctx, roomID)
+	if err != nil {
+		return pgstore.Room{}, err
+	}
+
+	if room.Moderated == moderated {
+		return room, nil
+	}
+
+	room, err = apiHandler.query.UpdateRoomModeration(ctx, pgstore.UpdateRoomModerationParams{Moderated: moderated, ID: roomID})
+	if err != nil {
+		slog.Error(LogFailedToUpdateRoomModeration, "error", err)
+		return pgstore.Room{}, ErrSomethingWentWrong
+	}
+
+	apiHandler.broadcast(ctx, Message{
+		Kind:   MessageKindRoomModerationChanged,
+		RoomID: roomID.String(),
+		Value: MessageRoomModerationChanged{
+			Moderated: moderated,
+		},
+	})
+
+	return room, nil
+}
+
+// (n) MODERATE MESSAGE (host only)
+// pending -> approved (broadcast as message_created) | pending -> rejected (never shown)
+func (apiHandler apiHandler) moderateMessage(ctx context.Context, roomID, messageID uuid.UUID, status string) error {
+	if _, err := apiHandler.requireHost(ctx, roomID); err != nil {
+		return err
+	}
+
+	message, err := apiHandler.readAnyRoomMessage(ctx, roomID, messageID)
+	if err != nil {
+		return err
+	}
+	if message.Status != MessageStatusPending {
+		return ErrMessageNotPending
+	}
+
+	// Ps: only one of two concurrent moderations updates the row
+	rows, err := apiHandler.query.ModerateMessage(ctx, pgstore.ModerateMessageParams{Status: status, ID: messageID})
+	if err != nil {
+		slog.Error(LogFailedToModerateMessage, "error", err)
+		return ErrSomethingWentWrong
+	}
+	if rows == 0 {
+		return ErrMessageNotPending
+	}
+
+	if status == MessageStatusApproved {
+		apiHandler.broadcastMessageCreated(ctx, roomID, messageID, message.Message)
+	}
+
+	return nil
+}
@@ -6,16 +6,24 @@ import (
 	"context"
 	// JSON encoder/decoder
 	"encoding/json"
-	// Deal with errors
-	"errors"
 	// Keep Log
 	"log/slog"
 	// Native package to deal with HTTP
 	"net/http"
+	// IP addresses and prefixes (trusted proxies)
+	"net/netip"
+	// String conversions
+	"strconv"
 	// Sync package
 	"sync"
+	// Atomic flags (draining)
+	"sync/atomic"
+	// Close frame deadline
+	"time"
 
 	// INTERNAL PACKAGES
+	// Persistence interface implemented by pgstore and memstore
+	"github.com/alexandrecpedro/ama-room/backend/internal/store"
 	// Internal package that handles PostgreSQL database operations
 	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
 
@@ -30,15 +38,15 @@ import (
 	"github.com/google/uuid"
 	// Websocket
 	"github.com/gorilla/websocket"
-	// PGX v5
-	"github.com/jackc/pgx/v5"
+	// OpenTelemetry tracing
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Part 1: Interface structure
 type apiHandler struct {
-	//? TODO: use an interface on this parameter "query"
-	// (a) instance of pgstore.Queries, which presumably contains database queries
-	query *pgstore.Queries
+	// (a) store: persistence layer (pgstore.Queries on production, memstore.Store on tests and demos)
+	query store.Store
 	// (b) router for managing HTTP routes
 	router *chi.Mux
 	// (c) upgrader: upgrade HTTP request to websocket
@@ -46,9 +54,45 @@ type apiHandler struct {
 	// (d) subscribers: store all opened connections with clients
 	// Ps1: map[string] for map[opened_connections]; for each connection, save context.CancelFunc (option to cancel any operation running on Go)
 	// Ps2: maps is not thread safe (data race occurs)
-	subscribers map[string]map[*websocket.Conn]context.CancelFunc
+	subscribers map[string]map[*websocket.Conn]*subscriber
 	// (e) mux: mutex (mutual exclusion) block the data race
 	mu *sync.Mutex
+	// (e.1) eventLocks: keep the events of a room published in the order of their sequence number
+	// Ps: only when the handler records the events itself (see recordAndPublish)
+	eventLocks *roomLocks
+	// (f) broadcaster: fans room events out to every instance (in-process by default)
+	broadcaster Broadcaster
+	// (g) websocket: per subscriber queue and timeouts
+	websocket websocketConfig
+	// (h) participantSecret: key used to sign participant tokens
+	participantSecret []byte
+	// (i) messageFilters: checks run on participant text before it is stored
+	messageFilters []MessageFilter
+	// (j) rateLimiter: token buckets per route class and client
+	rateLimiter *rateLimiter
+	// (k) trustedProxies: proxies allowed to report the client IP (X-Forwarded-For)
+	trustedProxies []netip.Prefix
+	// (l) draining: set by Shutdown; connections: websocket subscriptions still running
+	draining    *atomic.Bool
+	connections *sync.WaitGroup
+	// (m) metrics: Prometheus collectors served on /metrics
+	metrics *metrics
+	// (n) readinessChecks: dependencies checked by /readyz (besides draining)
+	readinessChecks []ReadinessCheck
+	// (o) tracer: spans of requests, commands and broadcasts
+	tracer trace.Tracer
+	// (p) allowedOrigins: origins allowed by CORS (* is a wildcard)
+	allowedOrigins []string
+}
+
+// Option customizes the handler created by NewHandler
+type Option func(*apiHandler)
+
+// WithAllowedOrigins sets the origins allowed by CORS (any http or https origin by default)
+func WithAllowedOrigins(origins []string) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.allowedOrigins = append([]string{}, origins...)
+	}
 }
 
 // Part 2: Method from interface
@@ -59,15 +103,49 @@ func (handler apiHandler) ServeHTTP(respWriter http.ResponseWriter, req *http.Re
 }
 
 // Part 3: Function that creates and returns a new HTTP handler
-func NewHandler(query *pgstore.Queries) http.Handler {
+func NewHandler(query store.Store, opts ...Option) Handler {
 	// Instantiate apiHandler type
 	apiHandler := apiHandler{
 		query: query,
-		// Ps: CheckOrigin is a closure
-		upgrader: websocket.Upgrader{CheckOrigin: func(req *http.Request) bool { return true }},
+		// Ps: CheckOrigin and Error are closures
+		upgrader: websocket.Upgrader{
+			// Ps: credentials offered as subprotocols are never selected (see credentials.go)
+			Subprotocols: []string{websocketProtocol},
+			CheckOrigin:  func(req *http.Request) bool { return true },
+			Error: func(respWriter http.ResponseWriter, req *http.Request, status int, _ error) {
+				// keep the status chosen by the upgrader (400, 403, 405...)
+				upgradeErr := *ErrUpgradeToWebsocketConnection
+				upgradeErr.Status = status
+				sendError(respWriter, req, &upgradeErr)
+			},
+		},
 		// need to initialize the map (default = start as null)
-		subscribers: make(map[string]map[*websocket.Conn]context.CancelFunc),
+		subscribers: make(map[string]map[*websocket.Conn]*subscriber),
 		mu:          &sync.Mutex{},
+		eventLocks:  newRoomLocks(),
+		broadcaster: NewLocalBroadcaster(),
+		websocket:   defaultWebsocketConfig,
+		rateLimiter: newRateLimiter(),
+		draining:    &atomic.Bool{},
+		connections: &sync.WaitGroup{},
+		// Ps: the global provider is a no-op until tracing.Setup installs one
+		tracer:         otel.Tracer(tracerName),
+		allowedOrigins: []string{"https://*", "http://*"},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		opt(&apiHandler)
+	}
+	if apiHandler.participantSecret == nil {
+		slog.Warn("No participant secret set: participant tokens will not survive a restart")
+		apiHandler.participantSecret = newParticipantSecret()
+	}
+	if apiHandler.messageFilters == nil {
+		apiHandler.messageFilters = []MessageFilter{NewMaxLengthFilter(defaultMaxMessageLength)}
+	}
+	if apiHandler.metrics == nil {
+		apiHandler.metrics = newMetrics(NewMetricsRegistry())
 	}
 
 	// Create new router
@@ -75,60 +153,118 @@ func NewHandler(query *pgstore.Queries) http.Handler {
 
 	// Set middlewares on router
 	// (a) RequestID => assigns a unique ID to each request
-	// (b) Recoverer => prevents the server from crashing in case of a panic
-	// (c) Logger => keep a log of all requests
-	router.Use(middleware.RequestID, middleware.Recoverer, middleware.Logger)
+	// (a.1) redactCredentials => strips credentials sent in the URL, before anything logs it
+	// (b) traceRequest => one span per request, named after the route pattern
+	// (c) instrument => count and time requests by route pattern (outside recoverer, so panics count as 500)
+	// (d) recoverer => prevents the server from crashing in case of a panic
+	// (e) Logger => keep a log of all requests
+	router.Use(middleware.RequestID, redactCredentials, apiHandler.traceRequest, apiHandler.instrument, recoverer, middleware.Logger)
+
+	// Unknown routes and methods also answer with problem details
+	router.NotFound(func(respWriter http.ResponseWriter, req *http.Request) {
+		sendError(respWriter, req, ErrRouteNotFound)
+	})
+	router.MethodNotAllowed(func(respWriter http.ResponseWriter, req *http.Request) {
+		sendError(respWriter, req, ErrMethodNotAllowed)
+	})
 
 	// Set CORS
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedOrigins:   apiHandler.allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", participantTokenHeader},
+		ExposedHeaders:   []string{"Link", nextCursorHeader, "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
+	// Set client IP (trusted proxies aware), participant identification (signed token => participant id)
+	// and host secret (checked against the room by host-only operations), all on the request context
+	router.Use(apiHandler.resolveClientIP, apiHandler.resolveParticipant, resolveHostSecret)
+
 	// Set routes
 
+	// -- Metrics route (Prometheus text format)
+	router.Get("/metrics", apiHandler.handleMetrics)
+
+	// -- Health routes (liveness, readiness)
+	router.Get("/healthz", apiHandler.handleLiveness)
+	router.Get("/readyz", apiHandler.handleReadiness)
+
 	// -- Websockets route
 	// Ps: client will connect to an specific room and
 	// receives any changes that happens
-	router.Get("/subscribe/{room_id}", apiHandler.handleSubscribe)
+	router.With(traceRoom).Get("/subscribe/{room_id}", apiHandler.handleSubscribe)
 
 	// -- API routes
 	router.Route("/api", func(apiRouter chi.Router) {
+		// (0) Participants: issue an anonymous participant token
+		apiRouter.With(apiHandler.rateLimit(RateClassParticipants)).Post("/participants", apiHandler.handleCreateParticipant)
+
 		// Set subroutes
 		//* Ps: all routes will be associated with an specific room
 		// (a) Rooms
 		apiRouter.Route("/rooms", func(roomRouter chi.Router) {
 			// i. Register a room
-			roomRouter.Post("/", apiHandler.handleCreateRoom)
-			// ii. Get all rooms
+			roomRouter.With(apiHandler.rateLimit(RateClassRooms)).Post("/", apiHandler.handleCreateRoom)
+			// ii. Get rooms (paginated, newest first)
 			roomRouter.Get("/", apiHandler.handleGetRooms)
 
 			// (b) Specific room
-			roomRouter.Route("/{room_id}", func(r chi.Router) {
+			roomRouter.Route("/{room_id}", func(specRoomRouter chi.Router) {
+				specRoomRouter.Use(traceRoom)
+
 				// i. Get a room
-				roomRouter.Get("/", apiHandler.handleGetRoom)
+				specRoomRouter.Get("/", apiHandler.handleGetRoom)
+				// ii. Close, reopen or archive a room (host only)
+				specRoomRouter.Patch("/close", apiHandler.handleChangeRoomStatus(RoomStatusClosed))
+				specRoomRouter.Patch("/reopen", apiHandler.handleChangeRoomStatus(RoomStatusOpen))
+				specRoomRouter.Patch("/archive", apiHandler.handleChangeRoomStatus(RoomStatusArchived))
+				// iii. Turn the moderation queue on or off (host only)
+				specRoomRouter.Patch("/moderation", apiHandler.handleSetRoomModeration)
 
 				// (c) Room Messages
-				roomRouter.Route("/messages", func(messageRoomRouter chi.Router) {
+				specRoomRouter.Route("/messages", func(messageRoomRouter chi.Router) {
 					// i. Register message from a room
-					messageRoomRouter.Post("/", apiHandler.handleCreateRoomMessage)
-					// ii. Get all messages from a room
+					messageRoomRouter.With(apiHandler.rateLimit(RateClassMessages)).Post("/", apiHandler.handleCreateRoomMessage)
+					// ii. Get messages from a room (paginated, ?sort=newest|most_reacted|unanswered_first)
 					messageRoomRouter.Get("/", apiHandler.handleGetRoomMessages)
+					// iii. Get the moderation queue (host only, oldest first)
+					messageRoomRouter.Get("/pending", apiHandler.handleGetPendingRoomMessages)
 
 					// (d) Specific Message
 					messageRoomRouter.Route("/{message_id}", func(specMessageRoomRouter chi.Router) {
 						// i. Get room message
 						specMessageRoomRouter.Get("/", apiHandler.handleGetRoomMessage)
-						// ii. Mark an specific room message as answered
+						// i.1 Delete a room message (host only)
+						specMessageRoomRouter.Delete("/", apiHandler.handleDeleteRoomMessage)
+						// ii. Mark an specific room message as answered (host only)
 						specMessageRoomRouter.Patch("/answer", apiHandler.handleMarkRoomMessageAsAnswered)
 						// iii. React to an specific room message
-						specMessageRoomRouter.Patch("/react", apiHandler.handleReactToRoomMessage)
+						specMessageRoomRouter.With(apiHandler.rateLimit(RateClassReactions)).Patch("/react", apiHandler.handleReactToRoomMessage)
 						// iv. Delete a reaction from a room message
-						specMessageRoomRouter.Delete("/react", apiHandler.handleRemoveReactFromRoomMessage)
+						specMessageRoomRouter.With(apiHandler.rateLimit(RateClassReactions)).Delete("/react", apiHandler.handleRemoveReactFromRoomMessage)
+						// v. Approve or reject a pending message (host only)
+						specMessageRoomRouter.Patch("/approve", apiHandler.handleModerateRoomMessage(MessageStatusApproved))
+						specMessageRoomRouter.Patch("/reject", apiHandler.handleModerateRoomMessage(MessageStatusRejected))
+
+						// (e) Message answers (host only)
+						specMessageRoomRouter.Route("/answers", func(answerRouter chi.Router) {
+							// i. Answer a message
+							answerRouter.Post("/", apiHandler.handleCreateAnswer)
+							// ii. Edit an answer
+							answerRouter.Patch("/{answer_id}", apiHandler.handleUpdateAnswer)
+							// iii. Delete an answer
+							answerRouter.Delete("/{answer_id}", apiHandler.handleDeleteAnswer)
+						})
+
+						// (f) Message replies
+						specMessageRoomRouter.Route("/replies", func(replyRouter chi.Router) {
+							// i. Reply to a message
+							replyRouter.With(apiHandler.rateLimit(RateClassMessages)).Post("/", apiHandler.handleCreateReply)
+							// ii. Get the replies of a message (oldest first)
+							replyRouter.Get("/", apiHandler.handleGetReplies)
+						})
 					})
 				})
 			})
@@ -137,6 +273,12 @@ func NewHandler(query *pgstore.Queries) http.Handler {
 
 	// Assigns the router r to the apiHandler structure
 	apiHandler.router = router
+	// Events received by the broadcaster are written to the local subscribers
+	apiHandler.broadcaster.SetReceiver(apiHandler.notifyClients)
+	// Subscribers of a room whose events were lost resume from their last event
+	if reporter, ok := apiHandler.broadcaster.(GapReporter); ok {
+		reporter.SetGapHandler(apiHandler.resumeSubscribers)
+	}
 	// Returns the handler
 	return apiHandler
 }
@@ -144,10 +286,42 @@ func NewHandler(query *pgstore.Queries) http.Handler {
 // Part 4: CONSTANT VARIABLES
 // (a) Message object constants
 const (
+	MessageKindAnswerCreated            = "answer_created"
+	MessageKindAnswerDeleted            = "answer_deleted"
+	MessageKindAnswerUpdated            = "answer_updated"
 	MessageKindMessageAnswered          = "message_answered"
 	MessageKindMessageCreated           = "message_created"
+	MessageKindMessageDeleted           = "message_deleted"
 	MessageKindMessageReactionDecreased = "message_reaction_decreased"
 	MessageKindMessageReactionIncreased = "message_reaction_increased"
+	MessageKindMessageReplyCreated      = "message_reply_created"
+	MessageKindRoomModerationChanged    = "room_moderation_changed"
+	MessageKindRoomStatusChanged        = "room_status_changed"
+	MessageKindCommandAck               = "command_ack"
+	MessageKindCommandError             = "command_error"
+)
+
+// (b) Command object constants (client -> server)
+const (
+	CommandKindCreateMessage = "create_message"
+	CommandKindDeleteMessage = "delete_message"
+	CommandKindMarkAnswered  = "mark_answered"
+	CommandKindReact         = "react"
+	CommandKindUnreact       = "unreact"
+)
+
+// (c) Room status constants (see migration 008)
+const (
+	RoomStatusOpen     = "open"
+	RoomStatusClosed   = "closed"
+	RoomStatusArchived = "archived"
+)
+
+// (d) Message status constants (see migration 011)
+const (
+	MessageStatusPending  = "pending"
+	MessageStatusApproved = "approved"
+	MessageStatusRejected = "rejected"
 )
 
 // Part 6: Functions related to each HTTP method
@@ -155,18 +329,36 @@ const (
 // i. GET: handleSubscribe
 func (apiHandler apiHandler) handleSubscribe(respWriter http.ResponseWriter, req *http.Request) {
 	// Verify if a room exists
-	_, rawRoomID, _, ok := apiHandler.readRoom(respWriter, req)
+	_, rawRoomID, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
+	// Resume from a known event (?since=SEQ)
+	// Ps: events after SEQ are replayed before live delivery starts
+	rawSince := req.URL.Query().Get("since")
+	var since int64
+	if rawSince != "" {
+		var err error
+		since, err = strconv.ParseInt(rawSince, 10, 64)
+		if err != nil || since < 0 {
+			sendError(respWriter, req, ErrInvalidSince)
+			return
+		}
+	}
+
+	// No new subscriptions while shutting down
+	if apiHandler.isDraining() {
+		sendError(respWriter, req, ErrShuttingDown)
+		return
+	}
+
 	// Upgrade connection with client
 	connection, err := apiHandler.upgrader.Upgrade(respWriter, req, nil)
 	if err != nil {
 		// the client is not able to upgrade to websocket
-		slog.Warn(ErrUpgradeToWebsocketConnection, "error", err)
-		// return error to user
-		http.Error(respWriter, ErrUpgradeToWebsocketConnection, http.StatusBadRequest)
+		// Ps: the upgrader has already answered (see upgrader.Error)
+		slog.Warn(LogUpgradeToWebsocketConnection, "error", err)
 		return
 	}
 
@@ -177,26 +369,66 @@ func (apiHandler apiHandler) handleSubscribe(respWriter http.ResponseWriter, req
 
 	// Store this connection on the connection pool
 	apiHandler.mu.Lock()
+	// Ps: Shutdown started during the upgrade
+	if apiHandler.isDraining() {
+		apiHandler.mu.Unlock()
+		cancel()
+		deadline := time.Now().Add(apiHandler.websocket.writeTimeout)
+		_ = connection.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down, reconnect"), deadline)
+		return
+	}
+	apiHandler.connections.Add(1)
+	defer apiHandler.connections.Done()
 	if _, ok := apiHandler.subscribers[rawRoomID]; !ok {
 		// initialize the map
-		apiHandler.subscribers[rawRoomID] = make(map[*websocket.Conn]context.CancelFunc)
+		apiHandler.subscribers[rawRoomID] = make(map[*websocket.Conn]*subscriber)
+		apiHandler.metrics.subscribedRooms.Inc()
 	}
 	// Keep logs
-	//? TODO: check the best form to get client IP (change from req.RemoteAddr)
-	slog.Info("New client connected!", "room_id", rawRoomID, "client_ip", req.RemoteAddr)
+	slog.Info("New client connected!", "room_id", rawRoomID, "client_ip", clientIPFromContext(req.Context()))
 	// Create this room on the map
-	apiHandler.subscribers[rawRoomID][connection] = cancel
+	sub := newSubscriber(connection, cancel, apiHandler.websocket, apiHandler.metrics, apiHandler.tracer)
+	sub.replaying = rawSince != ""
+	sub.rateLimitClients = rateLimitClients(req)
+	apiHandler.subscribers[rawRoomID][connection] = sub
+	apiHandler.metrics.subscribers.Inc()
 	// Enable to touch on mutex again
 	apiHandler.mu.Unlock()
 
-	// Keep this function running until it ends by client or server
-	<-connectionContext.Done()
-
 	// Remove our subscribe from subscriber list
 	// Ps: the context has being cancel
-	apiHandler.mu.Lock()
-	delete(apiHandler.subscribers[rawRoomID], connection)
-	apiHandler.mu.Unlock()
+	defer func() {
+		apiHandler.mu.Lock()
+		delete(apiHandler.subscribers[rawRoomID], connection)
+		apiHandler.metrics.subscribers.Dec()
+		if len(apiHandler.subscribers[rawRoomID]) == 0 {
+			// last local subscriber of this room has left
+			delete(apiHandler.subscribers, rawRoomID)
+			apiHandler.metrics.subscribedRooms.Dec()
+		}
+		apiHandler.mu.Unlock()
+	}()
+
+	// Receive the events of this room before replaying, so no event falls in between
+	// Ps: blocks until the broadcaster delivers them (e.g. LISTEN active on PostgreSQL)
+	if err := apiHandler.broadcaster.Listen(connectionContext, rawRoomID); err != nil {
+		return
+	}
+	defer apiHandler.broadcaster.Unlisten(rawRoomID)
+
+	// Send the events missed since the last connection
+	if rawSince != "" {
+		apiHandler.replay(connectionContext, roomID, sub, since)
+	}
+
+	// Read commands from the client (+ control frames and disconnect detection)
+	go sub.readPump(connectionContext, func(data []byte) {
+		apiHandler.handleCommand(connectionContext, sub, roomID, data)
+	})
+
+	// Write queued messages until it ends by client or server
+	// Ps: the network I/O happens here, without holding apiHandler.mu
+	sub.writePump(connectionContext)
 }
 
 // -- API ROUTES
@@ -204,49 +436,67 @@ func (apiHandler apiHandler) handleSubscribe(respWriter http.ResponseWriter, req
 // i. POST: handleCreateRoom
 func (apiHandler apiHandler) handleCreateRoom(respWriter http.ResponseWriter, req *http.Request) {
 	// body
+	// Ps: moderated => messages from participants wait for the host approval
 	type _body struct {
-		Theme string `json:"theme"`
+		Theme     string `json:"theme"`
+		Moderated bool   `json:"moderated"`
 	}
 
 	// Create variable from _body type
 	var body _body
 	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 		// return error to user
-		http.Error(respWriter, ErrInvalidJSON, http.StatusBadRequest)
+		sendError(respWriter, req, ErrInvalidJSON)
 		return
 	}
 
 	// Insert room at DB
-	roomID, err := apiHandler.query.InsertRoom(req.Context(), body.Theme)
+	// Ps: only the hash of the host secret is stored; the secret itself is returned once
+	hostSecret, hostSecretHash := newHostSecret()
+	roomID, err := apiHandler.query.InsertRoom(req.Context(), pgstore.InsertRoomParams{
+		Theme:          body.Theme,
+		HostSecretHash: hostSecretHash,
+		Moderated:      body.Moderated,
+	})
 	if err != nil {
 		// keep log
-		slog.Error(ErrFailedToRegisterRoom, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		slog.Error(LogFailedToRegisterRoom, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
 		return
 	}
 
 	// Response type to user
 	type response struct {
-		ID string `json:"id"`
+		ID         string `json:"id"`
+		HostSecret string `json:"host_secret"`
 	}
 
-	sendJSON(respWriter, response{ID: roomID.String()})
+	sendJSON(respWriter, req, response{ID: roomID.String(), HostSecret: hostSecret})
 }
 
 // ii. GET MANY: handleGetRooms
 func (apiHandler apiHandler) handleGetRooms(respWriter http.ResponseWriter, req *http.Request) {
-	rooms, err := apiHandler.query.GetRooms(req.Context())
+	p, ok := readPage(respWriter, req, SortNewest)
+	if !ok {
+		return
+	}
+
+	rooms, hasNext, err := apiHandler.getRoomsPage(req.Context(), p)
 	if err != nil {
-		slog.Error(ErrFailedToGetRooms, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		slog.Error(LogFailedToGetRooms, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
 		return
 	}
+	if hasNext {
+		setNextPage(respWriter, req, p, roomCursor(rooms[len(rooms)-1]))
+	}
 
-	if rooms == nil {
-		rooms = []pgstore.Room{}
+	response := make([]roomResponse, 0, len(rooms))
+	for _, room := range rooms {
+		response = append(response, newRoomResponse(room))
 	}
 
-	sendJSON(respWriter, rooms)
+	sendJSON(respWriter, req, response)
 }
 
 // iii. GET ONE: handleGetRoom
@@ -256,14 +506,60 @@ func (apiHandler apiHandler) handleGetRoom(respWriter http.ResponseWriter, req *
 		return
 	}
 
-	sendJSON(respWriter, room)
+	sendJSON(respWriter, req, newRoomResponse(room))
+}
+
+// iv. PATCH: handleChangeRoomStatus
+// Ps: one handler per target status (close => closed, reopen => open, archive => archived)
+func (apiHandler apiHandler) handleChangeRoomStatus(status string) http.HandlerFunc {
+	return func(respWriter http.ResponseWriter, req *http.Request) {
+		_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+		if !ok {
+			return
+		}
+
+		room, err := apiHandler.changeRoomStatus(req.Context(), roomID, status)
+		if err != nil {
+			sendError(respWriter, req, err)
+			return
+		}
+
+		sendJSON(respWriter, req, newRoomResponse(room))
+	}
+}
+
+// v. PATCH: handleSetRoomModeration
+func (apiHandler apiHandler) handleSetRoomModeration(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	// body
+	type _body struct {
+		Moderated *bool `json:"moderated"`
+	}
+
+	var body _body
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Moderated == nil {
+		sendError(respWriter, req, ErrInvalidJSON)
+		return
+	}
+
+	room, err := apiHandler.setRoomModeration(req.Context(), roomID, *body.Moderated)
+	if err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	sendJSON(respWriter, req, newRoomResponse(room))
 }
 
 // (b) ROOM MESSAGES
 // i. POST: handleCreateRoomMessage
 func (apiHandler apiHandler) handleCreateRoomMessage(respWriter http.ResponseWriter, req *http.Request) {
 	// Verify if a room exists
-	_, rawRoomID, roomID, ok := apiHandler.readRoom(respWriter, req)
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
@@ -277,140 +573,217 @@ func (apiHandler apiHandler) handleCreateRoomMessage(respWriter http.ResponseWri
 	var body _body
 	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 		// return error to user
-		http.Error(respWriter, ErrInvalidJSON, http.StatusBadRequest)
+		sendError(respWriter, req, ErrInvalidJSON)
 		return
 	}
 
-	messageID, err := apiHandler.query.InsertMessage(req.Context(), pgstore.InsertMessageParams{RoomID: roomID, Message: body.Message})
+	// Insert the message and notify all clients (or queue it for moderation)
+	result, err := apiHandler.createMessage(req.Context(), roomID, body.Message)
 	if err != nil {
-		// log the error
-		slog.Error(ErrFailedToInsertMessage, "error", err)
-		// return error to user
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		sendError(respWriter, req, err)
 		return
 	}
 
-	// Response type to user
-	type response struct {
-		ID string `json:"id"`
+	sendJSON(respWriter, req, result)
+}
+
+// ii. GET MANY: handleGetRooms
+func (apiHandler apiHandler) handleGetRoomMessages(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
 	}
 
-	sendJSON(respWriter, response{ID: messageID.String()})
+	p, ok := readPage(respWriter, req, SortNewest, SortMostReacted, SortUnansweredFirst)
+	if !ok {
+		return
+	}
 
-	// Notify all clients asynchronously
-	go apiHandler.notifyClients(Message{
-		Kind:   MessageKindMessageCreated,
-		RoomID: rawRoomID,
-		Value: MessageMessageCreated{
-			ID:      messageID.String(),
-			Message: body.Message,
-		},
-	})
+	messages, hasNext, err := apiHandler.getRoomMessagesPage(req.Context(), roomID, p)
+	if err != nil {
+		slog.Error(LogFailedToGetRoomMessages, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
+		return
+	}
+
+	// Tell the caller which messages they have already reacted to
+	reacted := make(map[uuid.UUID]bool)
+	if participantID, ok := participantFromContext(req.Context()); ok {
+		messageIDs, err := apiHandler.query.GetParticipantRoomReactions(req.Context(), pgstore.GetParticipantRoomReactionsParams{
+			RoomID:        roomID,
+			ParticipantID: participantID,
+		})
+		if err != nil {
+			slog.Error(LogFailedToGetReactions, "error", err)
+			sendError(respWriter, req, ErrSomethingWentWrong)
+			return
+		}
+		for _, messageID := range messageIDs {
+			reacted[messageID] = true
+		}
+	}
+
+	// Answers of the messages on this page
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+	}
+	answers, err := apiHandler.query.GetAnswersByMessageIDs(req.Context(), messageIDs)
+	if err != nil {
+		slog.Error(LogFailedToGetAnswers, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
+		return
+	}
+	answersByMessage := make(map[uuid.UUID][]pgstore.Answer)
+	for _, answer := range answers {
+		answersByMessage[answer.MessageID] = append(answersByMessage[answer.MessageID], answer)
+	}
+
+	response := make([]messageResponse, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, newMessageResponse(message, reacted[message.ID], answersByMessage[message.ID]))
+	}
+
+	if hasNext {
+		setNextPage(respWriter, req, p, messageCursor(messages[len(messages)-1]))
+	}
+	sendJSON(respWriter, req, response)
 }
 
-// ii. GET MANY: handleGetRooms
-func (apiHandler apiHandler) handleGetRoomMessages(respWriter http.ResponseWriter, req *http.Request) {
+// iii. GET MANY: handleGetPendingRoomMessages (host only)
+// Moderation queue, oldest first (not paginated: it is meant to be emptied)
+func (apiHandler apiHandler) handleGetPendingRoomMessages(respWriter http.ResponseWriter, req *http.Request) {
 	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
-	messages, err := apiHandler.query.GetRoomMessages(req.Context(), roomID)
+	if _, err := apiHandler.requireHost(req.Context(), roomID); err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	messages, err := apiHandler.query.GetRoomPendingMessages(req.Context(), roomID)
 	if err != nil {
-		slog.Error(ErrFailedToGetRoomMessages, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		slog.Error(LogFailedToGetPendingMessages, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
 		return
 	}
 
-	if messages == nil {
-		messages = []pgstore.Message{}
+	// Ps: pending messages have no reactions nor answers yet
+	response := make([]messageResponse, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, newMessageResponse(message, false, nil))
 	}
 
-	sendJSON(respWriter, messages)
+	sendJSON(respWriter, req, response)
 }
 
 // (c) SPECIFIC ROOM MESSAGE
 // i. GET ONE: handleGetRoomMessage
+// Ps: the host also sees pending and rejected messages
 func (apiHandler apiHandler) handleGetRoomMessage(respWriter http.ResponseWriter, req *http.Request) {
-	_, _, _, ok := apiHandler.readRoom(respWriter, req)
+	room, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
-	rawMessageID := chi.URLParam(req, "message_id")
-	messageID, err := uuid.Parse(rawMessageID)
-	if err != nil {
-		http.Error(respWriter, ErrInvalidMessageID, http.StatusBadRequest)
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
 		return
 	}
 
-	messages, err := apiHandler.query.GetMessage(req.Context(), messageID)
+	readMessage := apiHandler.readRoomMessage
+	if isHost(req.Context(), room) {
+		readMessage = apiHandler.readAnyRoomMessage
+	}
+	message, err := readMessage(req.Context(), roomID, messageID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			http.Error(respWriter, ErrMessageNotFound, http.StatusNotFound)
+		sendError(respWriter, req, err)
+		return
+	}
+
+	// Tell the caller whether they have already reacted
+	var reacted bool
+	if participantID, ok := participantFromContext(req.Context()); ok {
+		reacted, err = apiHandler.query.HasParticipantReacted(req.Context(), pgstore.HasParticipantReactedParams{
+			MessageID:     messageID,
+			ParticipantID: participantID,
+		})
+		if err != nil {
+			slog.Error(LogFailedToGetReactions, "error", err)
+			sendError(respWriter, req, ErrSomethingWentWrong)
 			return
 		}
+	}
+
+	answers, err := apiHandler.query.GetMessageAnswers(req.Context(), messageID)
+	if err != nil {
+		slog.Error(LogFailedToGetAnswers, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
+		return
+	}
+
+	sendJSON(respWriter, req, newMessageResponse(message, reacted, answers))
+}
+
+// i.1 DELETE: handleDeleteRoomMessage
+func (apiHandler apiHandler) handleDeleteRoomMessage(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
 
-		slog.Error(ErrFailedToGetRoomMessage, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+	if err := apiHandler.deleteMessage(req.Context(), roomID, messageID); err != nil {
+		sendError(respWriter, req, err)
 		return
 	}
 
-	sendJSON(respWriter, messages)
+	// Response return
+	respWriter.WriteHeader(http.StatusNoContent)
 }
 
 // ii. PATCH: handleMarkRoomMessageAsAnswered
 func (apiHandler apiHandler) handleMarkRoomMessageAsAnswered(respWriter http.ResponseWriter, req *http.Request) {
-	_, rawRoomID, _, ok := apiHandler.readRoom(respWriter, req)
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
-	rawMessageID := chi.URLParam(req, "message_id")
-	messageID, err := uuid.Parse(rawMessageID)
-	if err != nil {
-		http.Error(respWriter, ErrInvalidMessageID, http.StatusBadRequest)
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
 		return
 	}
 
-	err = apiHandler.query.MarkMessageAsAnswered(req.Context(), messageID)
-	if err != nil {
-		slog.Error(ErrFailedToMarkAsAnswered, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+	if err := apiHandler.markMessageAsAnswered(req.Context(), roomID, messageID); err != nil {
+		sendError(respWriter, req, err)
 		return
 	}
 
 	// Response return
 	respWriter.WriteHeader(http.StatusOK)
-
-	go apiHandler.notifyClients(Message{
-		Kind:   MessageKindMessageAnswered,
-		RoomID: rawRoomID,
-		Value: MessageMessageAnswered{
-			ID: rawMessageID,
-		},
-	})
-
 }
 
 // iii. PATCH: handleReactToRoomMessage
 func (apiHandler apiHandler) handleReactToRoomMessage(respWriter http.ResponseWriter, req *http.Request) {
-	_, rawRoomID, _, ok := apiHandler.readRoom(respWriter, req)
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
-	rawMessageID := chi.URLParam(req, "message_id")
-	messageID, err := uuid.Parse(rawMessageID)
-	if err != nil {
-		http.Error(respWriter, ErrInvalidMessageID, http.StatusBadRequest)
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
 		return
 	}
 
-	count, err := apiHandler.query.RemoveReactionFromMessage(req.Context(), messageID)
+	count, err := apiHandler.reactToMessage(req.Context(), roomID, messageID)
 	if err != nil {
-		slog.Error(ErrFailedToReactToMessage, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		sendError(respWriter, req, err)
 		return
 	}
 
@@ -418,36 +791,24 @@ func (apiHandler apiHandler) handleReactToRoomMessage(respWriter http.ResponseWr
 		Count int64 `json:"count"`
 	}
 
-	sendJSON(respWriter, response{Count: count})
-
-	go apiHandler.notifyClients(Message{
-		Kind:   MessageKindMessageReactionIncreased,
-		RoomID: rawRoomID,
-		Value: MessageMessageReactionIncreased{
-			ID:    rawMessageID,
-			Count: count,
-		},
-	})
+	sendJSON(respWriter, req, response{Count: count})
 }
 
 // iv. DELETE: handleRemoveReactFromRoomMessage
 func (apiHandler apiHandler) handleRemoveReactFromRoomMessage(respWriter http.ResponseWriter, req *http.Request) {
-	_, rawRoomID, _, ok := apiHandler.readRoom(respWriter, req)
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
 	if !ok {
 		return
 	}
 
-	rawMessageID := chi.URLParam(req, "message_id")
-	messageID, err := uuid.Parse(rawMessageID)
-	if err != nil {
-		http.Error(respWriter, ErrInvalidMessageID, http.StatusBadRequest)
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
 		return
 	}
 
-	count, err := apiHandler.query.RemoveReactionFromMessage(req.Context(), messageID)
+	count, err := apiHandler.removeReactionFromMessage(req.Context(), roomID, messageID)
 	if err != nil {
-		slog.Error(ErrFailedToRemoveReaction, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		sendError(respWriter, req, err)
 		return
 	}
 
@@ -455,14 +816,190 @@ func (apiHandler apiHandler) handleRemoveReactFromRoomMessage(respWriter http.Re
 		Count int64 `json:"count"`
 	}
 
-	sendJSON(respWriter, response{Count: count})
+	sendJSON(respWriter, req, response{Count: count})
+}
 
-	go apiHandler.notifyClients(Message{
-		Kind:   MessageKindMessageReactionDecreased,
-		RoomID: rawRoomID,
-		Value: MessageMessageReactionDecreased{
-			ID:    rawMessageID,
-			Count: count,
-		},
-	})
+// v. PATCH: handleModerateRoomMessage (host only)
+// Ps: one handler per target status (approve => approved, reject => rejected)
+func (apiHandler apiHandler) handleModerateRoomMessage(status string) http.HandlerFunc {
+	return func(respWriter http.ResponseWriter, req *http.Request) {
+		_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+		if !ok {
+			return
+		}
+
+		messageID, ok := readMessageID(respWriter, req)
+		if !ok {
+			return
+		}
+
+		if err := apiHandler.moderateMessage(req.Context(), roomID, messageID, status); err != nil {
+			sendError(respWriter, req, err)
+			return
+		}
+
+		// Response return
+		respWriter.WriteHeader(http.StatusOK)
+	}
+}
+
+// (d) MESSAGE ANSWERS
+// i. POST: handleCreateAnswer
+func (apiHandler apiHandler) handleCreateAnswer(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	// body
+	type _body struct {
+		Answer string `json:"answer"`
+	}
+
+	var body _body
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		sendError(respWriter, req, ErrInvalidJSON)
+		return
+	}
+
+	answer, err := apiHandler.createAnswer(req.Context(), roomID, messageID, body.Answer)
+	if err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	sendJSON(respWriter, req, newAnswerResponse(answer))
+}
+
+// ii. PATCH: handleUpdateAnswer
+func (apiHandler apiHandler) handleUpdateAnswer(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	answerID, ok := readAnswerID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	// body
+	type _body struct {
+		Answer string `json:"answer"`
+	}
+
+	var body _body
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		sendError(respWriter, req, ErrInvalidJSON)
+		return
+	}
+
+	answer, err := apiHandler.updateAnswer(req.Context(), roomID, messageID, answerID, body.Answer)
+	if err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	sendJSON(respWriter, req, newAnswerResponse(answer))
+}
+
+// iii. DELETE: handleDeleteAnswer
+func (apiHandler apiHandler) handleDeleteAnswer(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	answerID, ok := readAnswerID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	if err := apiHandler.deleteAnswer(req.Context(), roomID, messageID, answerID); err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	// Response return
+	respWriter.WriteHeader(http.StatusNoContent)
+}
+
+// (e) MESSAGE REPLIES
+// i. POST: handleCreateReply
+func (apiHandler apiHandler) handleCreateReply(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	// body
+	type _body struct {
+		Reply string `json:"reply"`
+	}
+
+	var body _body
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		sendError(respWriter, req, ErrInvalidJSON)
+		return
+	}
+
+	reply, err := apiHandler.createReply(req.Context(), roomID, messageID, body.Reply)
+	if err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	sendJSON(respWriter, req, newReplyResponse(reply))
+}
+
+// ii. GET MANY: handleGetReplies
+func (apiHandler apiHandler) handleGetReplies(respWriter http.ResponseWriter, req *http.Request) {
+	_, _, roomID, ok := apiHandler.readRoom(respWriter, req)
+	if !ok {
+		return
+	}
+
+	messageID, ok := readMessageID(respWriter, req)
+	if !ok {
+		return
+	}
+
+	if _, err := apiHandler.readRoomMessage(req.Context(), roomID, messageID); err != nil {
+		sendError(respWriter, req, err)
+		return
+	}
+
+	replies, err := apiHandler.query.GetMessageReplies(req.Context(), messageID)
+	if err != nil {
+		slog.Error(LogFailedToGetReplies, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
+		return
+	}
+
+	response := make([]replyResponse, 0, len(replies))
+	for _, reply := range replies {
+		response = append(response, newReplyResponse(reply))
+	}
+
+	sendJSON(respWriter, req, response)
 }
@@ -0,0 +1,478 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+
+	"github.com/gorilla/websocket"
+)
+
+// HANDLER TESTS
+// Every test runs the real router on top of memstore (no PostgreSQL needed)
+
+// (a) HELPERS
+func newTestServer(t *testing.T, opts ...api.Option) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(api.NewHandler(memstore.New(), opts...))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func doRequest(t *testing.T, server *httptest.Server, method, path, body string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, data
+}
+
+func decode[T any](t *testing.T, data []byte) T {
+	t.Helper()
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+
+	return value
+}
+
+func hostHeader(secret string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + secret}}
+}
+
+func createRoom(t *testing.T, server *httptest.Server) (roomID, hostSecret string) {
+	t.Helper()
+
+	resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/", `{"theme":"Go"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create room: %d %s", resp.StatusCode, data)
+	}
+
+	room := decode[struct {
+		ID         string `json:"id"`
+		HostSecret string `json:"host_secret"`
+	}](t, data)
+
+	return room.ID, room.HostSecret
+}
+
+func createMessage(t *testing.T, server *httptest.Server, roomID, text string) string {
+	t.Helper()
+
+	resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/"+roomID+"/messages/", `{"message":"`+text+`"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create message: %d %s", resp.StatusCode, data)
+	}
+
+	return decode[api.CommandCreateMessageResult](t, data).ID
+}
+
+// testEvent: a message read from the websocket (Value kept raw)
+type testEvent struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+	Seq   int64           `json:"seq"`
+}
+
+// subscribe connects to path, offering protocols (credentials) next to the wsrs subprotocol
+func subscribe(t *testing.T, server *httptest.Server, path string, protocols ...string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: append([]string{"wsrs"}, protocols...)}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("subscribe %s: %v (%v)", path, err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// waitSubscribed returns once the server handles commands from conn (so it also gets the room events)
+// Ps: sends an unknown command and waits for its command_error
+func waitSubscribed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	if err := conn.WriteJSON(api.Command{RequestID: "ready", Kind: "ready"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		event := readEvent(t, conn)
+		if event.Kind == api.MessageKindCommandError && strings.Contains(string(event.Value), `"ready"`) {
+			return
+		}
+	}
+}
+
+// sendCommand sends a command with value (marshalled) on conn
+func sendCommand(t *testing.T, conn *websocket.Conn, requestID, kind string, value any) {
+	t.Helper()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(api.Command{RequestID: requestID, Kind: kind, Value: data}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readEventOf skips events until one of kind
+func readEventOf(t *testing.T, conn *websocket.Conn, kind string) testEvent {
+	t.Helper()
+
+	for {
+		if event := readEvent(t, conn); event.Kind == kind {
+			return event
+		}
+	}
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) testEvent {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var event testEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+
+	return event
+}
+
+// expectNoEvent fails if conn receives anything within wait
+func expectNoEvent(t *testing.T, conn *websocket.Conn, wait time.Duration) {
+	t.Helper()
+
+	if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		t.Fatal(err)
+	}
+
+	var event testEvent
+	if err := conn.ReadJSON(&event); err == nil {
+		t.Fatalf("unexpected event %s %s", event.Kind, event.Value)
+	}
+}
+
+func expectProblem(t *testing.T, resp *http.Response, data []byte, status int, code string) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d (%s)", resp.StatusCode, status, data)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", contentType)
+	}
+
+	problem := decode[struct {
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}](t, data)
+	if problem.Status != status || problem.Code != code {
+		t.Fatalf("problem = %+v, want %d %s", problem, status, code)
+	}
+}
+
+// (b) ROOMS
+func TestCreateAndGetRoom(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	if hostSecret == "" {
+		t.Fatal("no host secret returned")
+	}
+
+	resp, data := doRequest(t, server, http.MethodGet, "/api/rooms/"+roomID, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get room: %d %s", resp.StatusCode, data)
+	}
+
+	room := decode[map[string]any](t, data)
+	if room["id"] != roomID || room["theme"] != "Go" || room["status"] != api.RoomStatusOpen {
+		t.Fatalf("room = %v", room)
+	}
+	if _, ok := room["host_secret_hash"]; ok {
+		t.Fatal("host secret hash exposed")
+	}
+}
+
+func TestGetUnknownRoom(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, data := doRequest(t, server, http.MethodGet, "/api/rooms/00000000-0000-0000-0000-000000000000", "", nil)
+	expectProblem(t, resp, data, http.StatusNotFound, api.ErrRoomNotFound.Code)
+
+	resp, data = doRequest(t, server, http.MethodGet, "/api/rooms/not-a-uuid", "", nil)
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidRoomID.Code)
+}
+
+// (c) MESSAGES
+func TestCreateAndListMessages(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	first := createMessage(t, server, roomID, "first")
+	second := createMessage(t, server, roomID, "second")
+
+	resp, data := doRequest(t, server, http.MethodGet, "/api/rooms/"+roomID+"/messages/", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list messages: %d %s", resp.StatusCode, data)
+	}
+
+	// Ps: newest first
+	messages := decode[[]struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}](t, data)
+	if len(messages) != 2 || messages[0].ID != second || messages[1].ID != first {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestDeleteMessageRequiresHost(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	messageID := createMessage(t, server, roomID, "question")
+	path := "/api/rooms/" + roomID + "/messages/" + messageID
+
+	resp, data := doRequest(t, server, http.MethodDelete, path, "", nil)
+	expectProblem(t, resp, data, http.StatusForbidden, api.ErrHostRequired.Code)
+
+	resp, data = doRequest(t, server, http.MethodDelete, path, "", hostHeader("wrong"))
+	expectProblem(t, resp, data, http.StatusForbidden, api.ErrHostRequired.Code)
+
+	resp, _ = doRequest(t, server, http.MethodDelete, path, "", hostHeader(hostSecret))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete message: %d", resp.StatusCode)
+	}
+
+	resp, data = doRequest(t, server, http.MethodGet, path, "", nil)
+	expectProblem(t, resp, data, http.StatusNotFound, api.ErrMessageNotFound.Code)
+}
+
+// Messages of a moderated room are hidden from participants until the host approves them
+func TestModerationQueue(t *testing.T) {
+	server := newTestServer(t)
+	resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/", `{"theme":"Go","moderated":true}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create room: %d %s", resp.StatusCode, data)
+	}
+	room := decode[struct {
+		ID         string `json:"id"`
+		HostSecret string `json:"host_secret"`
+	}](t, data)
+	path := "/api/rooms/" + room.ID + "/messages/"
+
+	conn := subscribe(t, server, "/subscribe/"+room.ID)
+	waitSubscribed(t, conn)
+
+	resp, data = doRequest(t, server, http.MethodPost, path, `{"message":"approved later"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create message: %d %s", resp.StatusCode, data)
+	}
+	created := decode[api.CommandCreateMessageResult](t, data)
+	if created.Status != api.MessageStatusPending {
+		t.Fatalf("status = %q, want %q", created.Status, api.MessageStatusPending)
+	}
+	approved := created.ID
+	rejected := createMessage(t, server, room.ID, "rejected later")
+
+	// i. Participants do not see them
+	resp, data = doRequest(t, server, http.MethodGet, path, "", nil)
+	if messages := decode[[]json.RawMessage](t, data); resp.StatusCode != http.StatusOK || len(messages) != 0 {
+		t.Fatalf("list messages: %d %s", resp.StatusCode, data)
+	}
+	resp, data = doRequest(t, server, http.MethodGet, path+approved, "", nil)
+	expectProblem(t, resp, data, http.StatusNotFound, api.ErrMessageNotFound.Code)
+
+	// ii. The host gets them in the queue, oldest first
+	resp, data = doRequest(t, server, http.MethodGet, path+"pending", "", hostHeader(room.HostSecret))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("pending messages: %d %s", resp.StatusCode, data)
+	}
+	pending := decode[[]struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}](t, data)
+	if len(pending) != 2 || pending[0].ID != approved || pending[1].ID != rejected {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	// iii. Only the approved one is broadcast, once approved
+	resp, data = doRequest(t, server, http.MethodPatch, path+rejected+"/reject", "", hostHeader(room.HostSecret))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reject: %d %s", resp.StatusCode, data)
+	}
+	resp, data = doRequest(t, server, http.MethodPatch, path+approved+"/approve", "", hostHeader(room.HostSecret))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("approve: %d %s", resp.StatusCode, data)
+	}
+	resp, data = doRequest(t, server, http.MethodPatch, path+approved+"/approve", "", hostHeader(room.HostSecret))
+	expectProblem(t, resp, data, http.StatusConflict, api.ErrMessageNotPending.Code)
+
+	// Ps: the host is not moderated, so its message is the next event
+	hostMessage, data := doRequest(t, server, http.MethodPost, path, `{"message":"from the host"}`, hostHeader(room.HostSecret))
+	if hostMessage.StatusCode != http.StatusOK {
+		t.Fatalf("create host message: %d %s", hostMessage.StatusCode, data)
+	}
+	for _, want := range []string{approved, decode[api.CommandCreateMessageResult](t, data).ID} {
+		event := readEvent(t, conn)
+		value := decode[api.MessageMessageCreated](t, event.Value)
+		if event.Kind != api.MessageKindMessageCreated || value.ID != want {
+			t.Fatalf("event = %s %s, want message_created of %s", event.Kind, event.Value, want)
+		}
+	}
+
+	resp, data = doRequest(t, server, http.MethodGet, path+rejected, "", nil)
+	expectProblem(t, resp, data, http.StatusNotFound, api.ErrMessageNotFound.Code)
+	resp, data = doRequest(t, server, http.MethodGet, path+"pending", "", hostHeader(room.HostSecret))
+	if pending := decode[[]json.RawMessage](t, data); resp.StatusCode != http.StatusOK || len(pending) != 0 {
+		t.Fatalf("pending messages: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestModerationRequiresHost(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	path := "/api/rooms/" + roomID
+	messageID := createMessage(t, server, roomID, "question")
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, path + "/messages/pending", ""},
+		{http.MethodPatch, path + "/messages/" + messageID + "/approve", ""},
+		{http.MethodPatch, path + "/messages/" + messageID + "/reject", ""},
+		{http.MethodPatch, path + "/moderation", `{"moderated":true}`},
+	}
+	for _, request := range requests {
+		for _, header := range []http.Header{nil, hostHeader("wrong")} {
+			resp, data := doRequest(t, server, request.method, request.path, request.body, header)
+			expectProblem(t, resp, data, http.StatusForbidden, api.ErrHostRequired.Code)
+		}
+	}
+
+	// Ps: the room stays unmoderated
+	resp, data := doRequest(t, server, http.MethodGet, path, "", nil)
+	if room := decode[map[string]any](t, data); resp.StatusCode != http.StatusOK || room["moderated"] != false {
+		t.Fatalf("room = %d %s", resp.StatusCode, data)
+	}
+
+	resp, data = doRequest(t, server, http.MethodPatch, path+"/messages/"+messageID+"/approve", "", hostHeader(hostSecret))
+	expectProblem(t, resp, data, http.StatusConflict, api.ErrMessageNotPending.Code)
+}
+
+// Answers are limited to 1000 characters (not bytes), on create and on update
+func TestAnswerLengthLimit(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	path := "/api/rooms/" + roomID + "/messages/" + createMessage(t, server, roomID, "question") + "/answers/"
+	longest, tooLong := strings.Repeat("é", 1000), strings.Repeat("é", 1001)
+
+	resp, data := doRequest(t, server, http.MethodPost, path, `{"answer":"`+tooLong+`"}`, hostHeader(hostSecret))
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidAnswer.Code)
+
+	resp, data = doRequest(t, server, http.MethodPost, path, `{"answer":"`+longest+`"}`, hostHeader(hostSecret))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create answer: %d %s", resp.StatusCode, data)
+	}
+	answerID := decode[struct {
+		ID string `json:"id"`
+	}](t, data).ID
+
+	resp, data = doRequest(t, server, http.MethodPatch, path+answerID, `{"answer":"`+tooLong+`"}`, hostHeader(hostSecret))
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidAnswer.Code)
+}
+
+// (d) SUBSCRIPTIONS
+func TestSubscribeReceivesAndReplaysEvents(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+
+	live := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, live)
+	first := createMessage(t, server, roomID, "first")
+	second := createMessage(t, server, roomID, "second")
+
+	for i, messageID := range []string{first, second} {
+		event := readEvent(t, live)
+		created := decode[api.MessageMessageCreated](t, event.Value)
+		if event.Kind != api.MessageKindMessageCreated || event.Seq != int64(i+1) || created.ID != messageID {
+			t.Fatalf("live event %d = %+v", i, event)
+		}
+	}
+
+	// Ps: a client that saw the first event only gets the second one again
+	resumed := subscribe(t, server, "/subscribe/"+roomID+"?since=1")
+	event := readEvent(t, resumed)
+	if event.Seq != 2 || decode[api.MessageMessageCreated](t, event.Value).ID != second {
+		t.Fatalf("replayed event = %+v", event)
+	}
+	expectNoEvent(t, resumed, 100*time.Millisecond)
+}
+
+// A plain GET (no upgrade headers) fails like any other error: problem+json
+func TestSubscribeWithoutUpgrade(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+
+	resp, data := doRequest(t, server, http.MethodGet, "/subscribe/"+roomID, "", nil)
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrUpgradeToWebsocketConnection.Code)
+}
+
+// (e) HEALTH
+func TestReadiness(t *testing.T) {
+	resp, data := doRequest(t, newTestServer(t), http.MethodGet, "/readyz", "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("ready: %d %s %s", resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	}
+
+	failing := api.ReadinessCheck{Name: "database", Check: func(context.Context) error {
+		return errors.New("unreachable")
+	}}
+	resp, data = doRequest(t, newTestServer(t, api.WithReadinessChecks(failing)), http.MethodGet, "/readyz", "", nil)
+	expectProblem(t, resp, data, http.StatusServiceUnavailable, api.ErrNotReady.Code)
+
+	// Ps: the problem keeps the detail of each check
+	checks := decode[struct {
+		Checks []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"checks"`
+	}](t, data).Checks
+	if len(checks) != 2 || checks[1].Name != "database" || checks[1].Status != api.HealthStatusFailing || checks[1].Error != "unreachable" {
+		t.Fatalf("checks = %+v", checks)
+	}
+}
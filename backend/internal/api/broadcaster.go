@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gorilla/websocket"
+)
+
+// Broadcaster fans room events out to every instance that holds subscribers of that room
+// Ps1: apiHandler publishes through the broadcaster and only writes to its own websocket
+// connections from the receiver callback, so local and remote events take the same path
+// Ps2: every subscriber calls Listen when it connects and Unlisten when it leaves (the
+// broadcaster counts them); Listen blocks until the events published from then on are
+// delivered, so handleSubscribe replays the missed ones right after without a gap
+type Broadcaster interface {
+	// Publish sends msg to every instance listening on msg.RoomID
+	Publish(ctx context.Context, msg Message) error
+	// Listen starts delivering events of roomID to the receiver and returns once it does
+	// Ps: on error (ctx done) the subscription is undone, Unlisten must not be called
+	Listen(ctx context.Context, roomID string) error
+	// Unlisten stops delivering events of roomID to the receiver (after its last subscriber)
+	Unlisten(roomID string)
+	// SetReceiver registers the callback that delivers messages to the local subscribers
+	SetReceiver(receive func(Message))
+}
+
+// EventRecorder is implemented by broadcasters that record room events themselves
+// Ps: PGBroadcaster records the event and notifies it in one transaction, so replicas receive
+// the events of a room in sequence order (see PGBroadcaster.RecordAndPublish)
+type EventRecorder interface {
+	// RecordAndPublish persists msg as a room event (assigning its sequence number) and publishes it
+	RecordAndPublish(ctx context.Context, msg Message) (int64, error)
+}
+
+// GapReporter is implemented by broadcasters that can lose events (e.g. PGBroadcaster when
+// its listener connection breaks)
+// Ps: the handler closes the subscribers of the room, so they resume with ?since=SEQ
+type GapReporter interface {
+	// SetGapHandler registers the callback run for every room whose events may have been lost
+	SetGapHandler(handle func(roomID string))
+}
+
+// resumeSubscribers closes the subscribers of roomID with 1013 (try again later) once their
+// queued events are sent, so they reconnect with ?since=SEQ and get the lost events replayed
+// Ps: the gap handler of the broadcaster (see GapReporter)
+func (apiHandler apiHandler) resumeSubscribers(roomID string) {
+	apiHandler.mu.Lock()
+	defer apiHandler.mu.Unlock()
+
+	for _, sub := range apiHandler.subscribers[roomID] {
+		sub.goAway(websocket.CloseTryAgainLater, "Room events may have been missed")
+	}
+}
+
+// WithBroadcaster replaces the default in-process broadcaster
+func WithBroadcaster(broadcaster Broadcaster) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.broadcaster = broadcaster
+	}
+}
+
+// localBroadcaster delivers every message straight to the receiver (single instance deployments)
+type localBroadcaster struct {
+	receive func(Message)
+}
+
+// NewLocalBroadcaster creates the default in-process broadcaster
+func NewLocalBroadcaster() Broadcaster {
+	return &localBroadcaster{}
+}
+
+func (broadcaster *localBroadcaster) Publish(_ context.Context, msg Message) error {
+	if broadcaster.receive != nil {
+		broadcaster.receive(msg)
+	}
+	return nil
+}
+
+func (broadcaster *localBroadcaster) Listen(context.Context, string) error { return nil }
+
+func (broadcaster *localBroadcaster) Unlisten(string) {}
+
+func (broadcaster *localBroadcaster) SetReceiver(receive func(Message)) {
+	broadcaster.receive = receive
+}
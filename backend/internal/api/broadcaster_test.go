@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// gatedBroadcaster: like PGBroadcaster, events published before Listen returns are lost
+// Ps: Listen returns once gate is closed
+type gatedBroadcaster struct {
+	gate chan struct{}
+
+	mu        sync.Mutex
+	receive   func(api.Message)
+	gap       func(roomID string)
+	listening map[string]bool
+}
+
+func newGatedBroadcaster() *gatedBroadcaster {
+	return &gatedBroadcaster{gate: make(chan struct{}), listening: make(map[string]bool)}
+}
+
+func (broadcaster *gatedBroadcaster) Publish(_ context.Context, msg api.Message) error {
+	broadcaster.mu.Lock()
+	receive, listening := broadcaster.receive, broadcaster.listening[msg.RoomID]
+	broadcaster.mu.Unlock()
+
+	if listening {
+		receive(msg)
+	}
+	return nil
+}
+
+func (broadcaster *gatedBroadcaster) Listen(ctx context.Context, roomID string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-broadcaster.gate:
+	}
+
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+	broadcaster.listening[roomID] = true
+	return nil
+}
+
+func (broadcaster *gatedBroadcaster) Unlisten(string) {}
+
+func (broadcaster *gatedBroadcaster) SetReceiver(receive func(api.Message)) {
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+	broadcaster.receive = receive
+}
+
+func (broadcaster *gatedBroadcaster) SetGapHandler(handle func(roomID string)) {
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+	broadcaster.gap = handle
+}
+
+// An event recorded while the broadcaster is not listening yet is replayed (not lost)
+func TestSubscribeReplaysAfterListening(t *testing.T) {
+	broadcaster := newGatedBroadcaster()
+	server := newTestServer(t, api.WithBroadcaster(broadcaster))
+	roomID, _ := createRoom(t, server)
+
+	conn := subscribe(t, server, "/subscribe/"+roomID+"?since=0")
+	messageID := createMessage(t, server, roomID, "asked while listening")
+	close(broadcaster.gate)
+
+	event := readEvent(t, conn)
+	if event.Kind != api.MessageKindMessageCreated || event.Seq != 1 || decode[api.MessageMessageCreated](t, event.Value).ID != messageID {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+// Subscribers of a room whose events were lost are closed with 1013 and a ?since hint
+func TestSubscribersResumeAfterGap(t *testing.T) {
+	broadcaster := newGatedBroadcaster()
+	close(broadcaster.gate)
+	server := newTestServer(t, api.WithBroadcaster(broadcaster))
+	roomID, _ := createRoom(t, server)
+
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+	createMessage(t, server, roomID, "question")
+	if event := readEvent(t, conn); event.Seq != 1 {
+		t.Fatalf("event = %+v", event)
+	}
+
+	broadcaster.mu.Lock()
+	gap := broadcaster.gap
+	broadcaster.mu.Unlock()
+	gap(roomID)
+
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater || !strings.Contains(closeErr.Text, "?since=1") {
+		t.Fatalf("read after gap: %v", err)
+	}
+}
+
+// PGBroadcaster against a real database (skipped unless WSRS_TEST_DATABASE_URL is set)
+// Ps: Listen returns with LISTEN active, and a broken listener connection is reported as a gap
+func TestPGBroadcasterListenAndGap(t *testing.T) {
+	databaseURL := os.Getenv("WSRS_TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("WSRS_TEST_DATABASE_URL not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	broadcaster := api.NewPGBroadcaster(ctx, pool)
+	received := make(chan api.Message, 1)
+	gaps := make(chan string, 1)
+	broadcaster.SetReceiver(func(msg api.Message) { received <- msg })
+	broadcaster.SetGapHandler(func(roomID string) { gaps <- roomID })
+
+	roomID := uuid.NewString()
+	listenAndPublish := func() {
+		t.Helper()
+
+		listenCtx, cancelListen := context.WithTimeout(ctx, 5*time.Second)
+		defer cancelListen()
+		if err := broadcaster.Listen(listenCtx, roomID); err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		// Ps: published right after Listen, so it is delivered only if LISTEN is already active
+		if err := broadcaster.Publish(ctx, api.Message{Kind: "test", Value: "value", RoomID: roomID}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-received:
+			if msg.RoomID != roomID || msg.Kind != "test" {
+				t.Fatalf("received %+v", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("notification not delivered")
+		}
+	}
+	listenAndPublish()
+
+	// Break the listener connection (its last statement is the LISTEN of the room)
+	if _, err := pool.Exec(ctx, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE query LIKE 'LISTEN %' AND pid <> pg_backend_pid()"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lost := <-gaps:
+		if lost != roomID {
+			t.Fatalf("gap on %s, want %s", lost, roomID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("gap not reported")
+	}
+
+	// Ps: a new subscriber waits for the reconnection
+	listenAndPublish()
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// CLIENT IP
+// Behind a reverse proxy req.RemoteAddr is the proxy; the client is then read from the
+// headers set by the proxy, but only through hops listed as trusted proxies (anyone can send them)
+// Ps1: headers, by priority: Forwarded (RFC 7239), X-Forwarded-For, X-Real-IP
+// Ps2: the resolved IP is kept on the request context (logging, rate limiting, bans);
+// req.RemoteAddr is left untouched
+
+// clientIPKey is the request context key holding the client IP
+type clientIPKey struct{}
+
+// WithTrustedProxies sets the proxies (CIDR prefixes) allowed to report the client IP
+// Ps: without it the forwarding headers are ignored and the client IP is req.RemoteAddr
+func WithTrustedProxies(prefixes []netip.Prefix) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.trustedProxies = append([]netip.Prefix{}, prefixes...)
+	}
+}
+
+// (a) RESOLVE CLIENT IP (middleware)
+// Store the client IP on the request context
+func (apiHandler apiHandler) resolveClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), clientIPKey{}, apiHandler.clientIP(req))
+		next.ServeHTTP(respWriter, req.WithContext(ctx))
+	})
+}
+
+// (b) CLIENT IP FROM CONTEXT
+// Ps: empty when resolveClientIP did not run
+func clientIPFromContext(ctx context.Context) string {
+	clientIP, _ := ctx.Value(clientIPKey{}).(string)
+	return clientIP
+}
+
+// (c) CLIENT IP
+// Walk the hops from the nearest one and stop at the first that is not a trusted proxy
+func (apiHandler apiHandler) clientIP(req *http.Request) string {
+	remoteIP, ok := parseIP(req.RemoteAddr)
+	if !ok {
+		return req.RemoteAddr
+	}
+	if !apiHandler.isTrustedProxy(remoteIP) {
+		return remoteIP.String()
+	}
+
+	client := remoteIP
+	hops := forwardedHops(req)
+	for i := len(hops) - 1; i >= 0 && apiHandler.isTrustedProxy(client); i-- {
+		hop, ok := parseIP(hops[i])
+		if !ok {
+			// Ps: "unknown", obfuscated identifiers and garbage end the walk
+			break
+		}
+		client = hop
+	}
+
+	return client.String()
+}
+
+// forwardedHops: the client and proxies reported by the headers, the farthest first
+func forwardedHops(req *http.Request) []string {
+	// i. Forwarded: for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		var hops []string
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			hop := "unknown"
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	// ii. X-Forwarded-For: client, proxy1, proxy2
+	if forwardedFor := req.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		return strings.Split(strings.Join(forwardedFor, ","), ",")
+	}
+
+	// iii. X-Real-IP: client
+	if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+		return []string{realIP}
+	}
+
+	return nil
+}
+
+// (d) IS TRUSTED PROXY
+func (apiHandler apiHandler) isTrustedProxy(ip netip.Addr) bool {
+	for _, prefix := range apiHandler.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP reads "IP", "IP:PORT", "[IPv6]" or "[IPv6]:PORT" (IPv4-mapped IPv6 addresses are unmapped)
+func parseIP(raw string) (netip.Addr, bool) {
+	raw = strings.TrimSpace(raw)
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+
+	ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// Internal test: clientIP decides the rate limit and ban identity from headers anyone can send
+func TestClientIP(t *testing.T) {
+	apiHandler := apiHandler{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "untrusted peer, forged headers ignored",
+			remoteAddr: "203.0.113.5:1234",
+			header: http.Header{
+				"Forwarded":       {"for=198.51.100.1"},
+				"X-Forwarded-For": {"198.51.100.2"},
+				"X-Real-Ip":       {"198.51.100.3"},
+			},
+			want: "203.0.113.5",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.7, 10.0.0.3, 10.0.0.2"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "walk stops at the first untrusted hop",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.7, 203.0.113.9, 10.0.0.2"}},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "multiple X-Forwarded-For lines",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.7", "10.0.0.2"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "multiple Forwarded lines",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=198.51.100.7", "for=10.0.0.2;proto=https"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "Forwarded wins over X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"For=198.51.100.8;proto=https"}, "X-Forwarded-For": {"198.51.100.9"}},
+			want:       "198.51.100.8",
+		},
+		{
+			name:       "unknown hop ends the walk",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=unknown, for=10.0.0.2"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "obfuscated hop ends the walk",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=_hidden"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "element without for ends the walk",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=198.51.100.7, proto=https"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "quoted IPv6 with port",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for="[2001:db8::17]:4711"`}},
+			want:       "2001:db8::17",
+		},
+		{
+			name:       "trusted IPv6 peer",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "IPv4-mapped addresses are unmapped",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			header:     http.Header{"X-Forwarded-For": {"::ffff:198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "X-Real-IP from a trusted peer",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Real-Ip": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "garbage hop keeps the trusted peer",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"not-an-ip"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "remote address without IP",
+			remoteAddr: "pipe",
+			want:       "pipe",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for key, values := range test.header {
+				req.Header[key] = values
+			}
+
+			if got := apiHandler.clientIP(req); got != test.want {
+				t.Fatalf("clientIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WEBSOCKET COMMANDS
+// Clients send Command{request_id, kind, value} on /subscribe/{room_id} and get back
+// command_ack (with the result) or command_error (with a code from the error catalog),
+// both carrying the same request_id
+// Ps: room events caused by a command are broadcast exactly as with the REST routes
+
+// handleCommand decodes and runs a command sent by sub on roomID
+func (apiHandler apiHandler) handleCommand(ctx context.Context, sub *subscriber, roomID uuid.UUID, data []byte) {
+	ctx, span := apiHandler.tracer.Start(ctx, "websocket.command",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrRoomID.String(roomID.String())),
+	)
+	defer span.End()
+
+	var command Command
+	if err := json.Unmarshal(data, &command); err != nil {
+		apiHandler.replyCommandError(span, sub, "", ErrInvalidCommand)
+		return
+	}
+	span.SetName("websocket.command " + command.Kind)
+	span.SetAttributes(attrCommandKind.String(command.Kind))
+
+	// Ps: commands share the rate limits of the matching REST routes
+	if err := apiHandler.checkCommandRateLimit(sub, command.Kind); err != nil {
+		apiHandler.replyCommandError(span, sub, command.RequestID, err)
+		return
+	}
+
+	result, err := apiHandler.runCommand(ctx, roomID, command)
+	if err != nil {
+		apiHandler.replyCommandError(span, sub, command.RequestID, err)
+		return
+	}
+
+	apiHandler.reply(sub, Message{
+		Kind:  MessageKindCommandAck,
+		Value: MessageCommandAck{RequestID: command.RequestID, Result: result},
+	})
+}
+
+// replyCommandError sends command_error to sub and records its code on span
+// Ps: like HTTP 4xx, client mistakes do not mark the span as failed
+func (apiHandler apiHandler) replyCommandError(span trace.Span, sub *subscriber, requestID string, err error) {
+	commandErr := newMessageCommandError(requestID, err)
+	span.SetAttributes(attrCommandError.String(commandErr.Code))
+	if commandErr.Code == ErrSomethingWentWrong.Code {
+		span.SetStatus(codes.Error, commandErr.Error)
+	}
+
+	apiHandler.reply(sub, Message{
+		Kind:  MessageKindCommandError,
+		Value: commandErr,
+	})
+}
+
+// runCommand dispatches command to the room action it names
+func (apiHandler apiHandler) runCommand(ctx context.Context, roomID uuid.UUID, command Command) (any, error) {
+	switch command.Kind {
+	// (a) create_message => {"id": MESSAGE_ID, "status": "approved" | "pending", "reason": FLAG_REASON}
+	case CommandKindCreateMessage:
+		var value CommandCreateMessage
+		if err := json.Unmarshal(command.Value, &value); err != nil {
+			return nil, ErrInvalidCommand
+		}
+
+		return apiHandler.createMessage(ctx, roomID, value.Message)
+
+	// (b) react / unreact => {"id": MESSAGE_ID, "count": REACTION_COUNT}
+	case CommandKindReact, CommandKindUnreact:
+		messageID, err := commandMessageID(command)
+		if err != nil {
+			return nil, err
+		}
+
+		var count int64
+		if command.Kind == CommandKindReact {
+			count, err = apiHandler.reactToMessage(ctx, roomID, messageID)
+		} else {
+			count, err = apiHandler.removeReactionFromMessage(ctx, roomID, messageID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return CommandReactionResult{ID: messageID.String(), Count: count}, nil
+
+	// (c) mark_answered / delete_message (host only) => no result
+	case CommandKindMarkAnswered, CommandKindDeleteMessage:
+		messageID, err := commandMessageID(command)
+		if err != nil {
+			return nil, err
+		}
+
+		if command.Kind == CommandKindMarkAnswered {
+			return nil, apiHandler.markMessageAsAnswered(ctx, roomID, messageID)
+		}
+		return nil, apiHandler.deleteMessage(ctx, roomID, messageID)
+
+	default:
+		return nil, ErrUnknownCommand
+	}
+}
+
+// commandMessageID decodes the {"id": MESSAGE_ID} value shared by several commands
+func commandMessageID(command Command) (uuid.UUID, error) {
+	var value CommandMessageID
+	if err := json.Unmarshal(command.Value, &value); err != nil {
+		return uuid.UUID{}, ErrInvalidCommand
+	}
+
+	messageID, err := uuid.Parse(value.ID)
+	if err != nil {
+		return uuid.UUID{}, ErrInvalidMessageID
+	}
+
+	return messageID, nil
+}
+
+// reply queues a message for sub only
+func (apiHandler apiHandler) reply(sub *subscriber, msg Message) {
+	apiHandler.mu.Lock()
+	defer apiHandler.mu.Unlock()
+
+	sub.enqueue(msg)
+}
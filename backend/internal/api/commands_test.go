@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+)
+
+// The event of a command is recorded before its ack, so the client never gets the ack first
+func TestCommandEventBeforeAck(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+
+	for i, requestID := range []string{"1", "2", "3"} {
+		value, _ := json.Marshal(api.CommandCreateMessage{Message: "question " + requestID})
+		if err := conn.WriteJSON(api.Command{RequestID: requestID, Kind: api.CommandKindCreateMessage, Value: value}); err != nil {
+			t.Fatal(err)
+		}
+
+		event := readEvent(t, conn)
+		if event.Kind != api.MessageKindMessageCreated || event.Seq != int64(i+1) {
+			t.Fatalf("command %s: first reply = %+v, want message_created seq %d", requestID, event, i+1)
+		}
+		if created := decode[api.MessageMessageCreated](t, event.Value); created.Message != "question "+requestID {
+			t.Fatalf("command %s: event = %+v", requestID, created)
+		}
+
+		ack := readEvent(t, conn)
+		result := decode[api.MessageCommandAck](t, ack.Value)
+		if ack.Kind != api.MessageKindCommandAck || result.RequestID != requestID {
+			t.Fatalf("command %s: second reply = %+v, want command_ack", requestID, ack)
+		}
+	}
+}
+
+// stalledStore: memstore, with InsertRoomEvent blocked until release is closed for every room
+// but the fast one
+type stalledStore struct {
+	store.Store
+	fastRoom string
+	release  chan struct{}
+}
+
+func (stalledStore stalledStore) InsertRoomEvent(ctx context.Context, arg pgstore.InsertRoomEventParams) (int64, error) {
+	if arg.RoomID.String() != stalledStore.fastRoom {
+		<-stalledStore.release
+	}
+	return stalledStore.Store.InsertRoomEvent(ctx, arg)
+}
+
+// Recording the event of a room never waits for the events of another room
+func TestEventsOfOtherRoomsDoNotWait(t *testing.T) {
+	query := &stalledStore{Store: memstore.New(), release: make(chan struct{})}
+	server := httptest.NewServer(api.NewHandler(query))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(query.release) })
+
+	// Ps: rooms are created before the store stalls (room_created is not an event)
+	stalledRoom, _ := createRoom(t, server)
+	fastRoom, _ := createRoom(t, server)
+	query.fastRoom = fastRoom
+
+	post := func(client *http.Client, roomID, text string) (*http.Response, error) {
+		return client.Post(server.URL+"/api/rooms/"+roomID+"/messages/", "application/json", strings.NewReader(`{"message":"`+text+`"}`))
+	}
+
+	// Ps: may fail once the test server is closed
+	go post(server.Client(), stalledRoom, "stalled")
+	time.Sleep(50 * time.Millisecond)
+
+	resp, err := post(&http.Client{Timeout: 2 * time.Second}, fastRoom, "fast")
+	if err != nil {
+		t.Fatalf("event of another room waited for the stalled one: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create message: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// CREDENTIALS
+// Participant tokens and host secrets travel in headers, never in the URL: URLs end up in
+// access logs (middleware.Logger prints the request URI), proxy logs and browser history
+// Ps1: browsers cannot set headers on websocket handshakes, so there they travel as extra
+// subprotocols next to websocketProtocol (Sec-WebSocket-Protocol header):
+// new WebSocket(url, ["wsrs", "participant-token." + token, "host-secret." + secret])
+// Ps2: the server only ever selects websocketProtocol, so credentials are not echoed back
+
+const (
+	// websocketProtocol: subprotocol selected on every websocket handshake
+	// Ps: browsers drop the connection when they offer subprotocols and none is selected
+	websocketProtocol = "wsrs"
+	// participantTokenProtocol + token carries the participant token on websocket handshakes
+	participantTokenProtocol = "participant-token."
+	// hostSecretProtocol + secret carries the host secret on websocket handshakes
+	hostSecretProtocol = "host-secret."
+)
+
+// credentialQueryParameters: credentials older clients sent in the URL
+// Ps: they are ignored, and stripped before anything logs the request (see redactCredentials)
+var credentialQueryParameters = []string{"participant_token", "host_secret"}
+
+// (a) PROTOCOL CREDENTIAL
+// Value of the subprotocol starting with prefix offered on a websocket handshake ("" if none)
+func protocolCredential(req *http.Request, prefix string) string {
+	if !websocket.IsWebSocketUpgrade(req) {
+		return ""
+	}
+
+	for _, protocol := range websocket.Subprotocols(req) {
+		if credential, ok := strings.CutPrefix(protocol, prefix); ok {
+			return credential
+		}
+	}
+
+	return ""
+}
+
+// (b) REDACT CREDENTIALS (middleware)
+// Remove the credential query parameters from the request, so the request log never holds them
+func redactCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		redacted := false
+		for _, parameter := range credentialQueryParameters {
+			if query.Has(parameter) {
+				query.Del(parameter)
+				redacted = true
+			}
+		}
+		if !redacted {
+			next.ServeHTTP(respWriter, req)
+			return
+		}
+
+		// Ps: shallow copy, the URL is shared with the original request
+		redactedURL := *req.URL
+		redactedURL.RawQuery = query.Encode()
+		redactedReq := req.WithContext(req.Context())
+		redactedReq.URL = &redactedURL
+		redactedReq.RequestURI = redactedURL.RequestURI()
+
+		next.ServeHTTP(respWriter, redactedReq)
+	})
+}
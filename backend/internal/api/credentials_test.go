@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/gorilla/websocket"
+)
+
+// captureRequestLog sends the request log (middleware.Logger) of the handlers created afterwards to a buffer
+func captureRequestLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	defaultLogger := middleware.DefaultLogger
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(buf, "", 0), NoColor: true})
+	t.Cleanup(func() { middleware.DefaultLogger = defaultLogger })
+
+	return buf
+}
+
+// The participant token is offered as a subprotocol on the handshake; only wsrs is selected
+func TestParticipantTokenSubprotocol(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	messageID := createMessage(t, server, roomID, "question")
+	token := createParticipant(t, server)
+
+	react, _ := json.Marshal(api.CommandMessageID{ID: messageID})
+	for _, tc := range []struct {
+		name      string
+		protocols []string
+		kind      string
+	}{
+		{"with token", []string{"participant-token." + token}, api.MessageKindCommandAck},
+		{"without token", nil, api.MessageKindCommandError},
+	} {
+		conn := subscribe(t, server, "/subscribe/"+roomID, tc.protocols...)
+		if conn.Subprotocol() != "wsrs" {
+			t.Fatalf("%s: subprotocol = %q, want wsrs", tc.name, conn.Subprotocol())
+		}
+
+		if err := conn.WriteJSON(api.Command{RequestID: "1", Kind: api.CommandKindReact, Value: react}); err != nil {
+			t.Fatal(err)
+		}
+		// Ps: the reaction event (with token) comes before the ack
+		reply := readEvent(t, conn)
+		if reply.Kind == api.MessageKindMessageReactionIncreased {
+			reply = readEvent(t, conn)
+		}
+		if reply.Kind != tc.kind {
+			t.Fatalf("%s: reply = %+v, want %s", tc.name, reply, tc.kind)
+		}
+	}
+}
+
+// The host secret is offered as a subprotocol on the handshake too
+func TestHostSecretSubprotocol(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+
+	for _, tc := range []struct {
+		name      string
+		protocols []string
+		kind      string
+	}{
+		{"without secret", nil, api.MessageKindCommandError},
+		{"with secret", []string{"host-secret." + hostSecret}, api.MessageKindCommandAck},
+	} {
+		messageID := createMessage(t, server, roomID, "question")
+		conn := subscribe(t, server, "/subscribe/"+roomID, tc.protocols...)
+		waitSubscribed(t, conn)
+
+		value, _ := json.Marshal(api.CommandMessageID{ID: messageID})
+		if err := conn.WriteJSON(api.Command{RequestID: "1", Kind: api.CommandKindDeleteMessage, Value: value}); err != nil {
+			t.Fatal(err)
+		}
+		// Ps: the message_deleted event (with secret) comes before the ack
+		reply := readEvent(t, conn)
+		if reply.Kind == api.MessageKindMessageDeleted {
+			reply = readEvent(t, conn)
+		}
+		if reply.Kind != tc.kind {
+			t.Fatalf("%s: reply = %+v, want %s", tc.name, reply, tc.kind)
+		}
+	}
+}
+
+func TestInvalidParticipantTokenSubprotocol(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"wsrs", "participant-token.forged"}}
+	_, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/subscribe/"+roomID, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("forged token: err = %v, resp = %v", err, resp)
+	}
+}
+
+// Credentials sent in the URL by older clients are ignored and never reach the request log
+func TestCredentialQueryParametersNotLogged(t *testing.T) {
+	requestLog := captureRequestLog(t)
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	messageID := createMessage(t, server, roomID, "question")
+	token := createParticipant(t, server)
+	messagePath := "/api/rooms/" + roomID + "/messages/" + messageID
+
+	resp, data := doRequest(t, server, http.MethodPatch, messagePath+"/react?participant_token="+token+"&keep=1", "", nil)
+	expectProblem(t, resp, data, http.StatusUnauthorized, api.ErrParticipantMissing.Code)
+
+	resp, data = doRequest(t, server, http.MethodDelete, messagePath+"?host_secret="+hostSecret, "", nil)
+	expectProblem(t, resp, data, http.StatusForbidden, api.ErrHostRequired.Code)
+
+	for _, secret := range []string{token, hostSecret} {
+		if strings.Contains(requestLog.String(), secret) {
+			t.Fatalf("credential logged:\n%s", requestLog)
+		}
+	}
+	if !strings.Contains(requestLog.String(), "/react?keep=1") {
+		t.Fatalf("request not logged:\n%s", requestLog)
+	}
+}
@@ -1,22 +1,89 @@
 package api
 
+import (
+	"net/http"
+)
+
+// ERROR CATALOG
+// Errors returned to clients (REST and websocket commands)
+// Ps1: Code is stable and machine readable (clients match on it); Message may be reworded
+// Ps2: REST responses carry them as RFC 7807 problem details (see sendError)
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+var (
+	ErrAnswerNotFound               = &Error{Code: "answer_not_found", Status: http.StatusNotFound, Message: "Answer not found!"}
+	ErrHostRequired                 = &Error{Code: "host_required", Status: http.StatusForbidden, Message: "Only the room host can do this (send the host secret as \"Authorization: Bearer <host_secret>\")!"}
+	ErrInvalidAnswer                = &Error{Code: "invalid_answer", Status: http.StatusBadRequest, Message: "Answer must not be empty nor longer than 1000 characters!"}
+	ErrInvalidAnswerID              = &Error{Code: "invalid_answer_id", Status: http.StatusBadRequest, Message: "Invalid answer id!"}
+	ErrInvalidCommand               = &Error{Code: "invalid_command", Status: http.StatusBadRequest, Message: "Invalid command!"}
+	ErrInvalidCursor                = &Error{Code: "invalid_cursor", Status: http.StatusBadRequest, Message: "Invalid cursor (use the one returned by the previous page with the same sort)!"}
+	ErrInvalidJSON                  = &Error{Code: "invalid_json", Status: http.StatusBadRequest, Message: "Invalid JSON!"}
+	ErrInvalidLimit                 = &Error{Code: "invalid_limit", Status: http.StatusBadRequest, Message: "Invalid limit (expected a number from 1 to 100)!"}
+	ErrInvalidMessageID             = &Error{Code: "invalid_message_id", Status: http.StatusBadRequest, Message: "Invalid message id!"}
+	ErrInvalidReply                 = &Error{Code: "invalid_reply", Status: http.StatusBadRequest, Message: "Reply must not be empty!"}
+	ErrInvalidParticipantToken      = &Error{Code: "invalid_participant_token", Status: http.StatusUnauthorized, Message: "Invalid participant token!"}
+	ErrInvalidRoomID                = &Error{Code: "invalid_room_id", Status: http.StatusBadRequest, Message: "Invalid room id!"}
+	ErrInvalidSince                 = &Error{Code: "invalid_since", Status: http.StatusBadRequest, Message: "Invalid since (expected an event sequence number)!"}
+	ErrInvalidSort                  = &Error{Code: "invalid_sort", Status: http.StatusBadRequest, Message: "Invalid sort!"}
+	ErrMessageRejected              = &Error{Code: "message_rejected", Status: http.StatusUnprocessableEntity, Message: "Message rejected by the content filters!"}
+	ErrMessageNotPending            = &Error{Code: "message_not_pending", Status: http.StatusConflict, Message: "This message is not waiting for moderation!"}
+	ErrMessageNotFound              = &Error{Code: "message_not_found", Status: http.StatusNotFound, Message: "Message not found!"}
+	ErrMethodNotAllowed             = &Error{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed, Message: "Method not allowed!"}
+	ErrNotReady                     = &Error{Code: "not_ready", Status: http.StatusServiceUnavailable, Message: "Not ready to receive traffic!"}
+	ErrParticipantMissing           = &Error{Code: "participant_missing", Status: http.StatusUnauthorized, Message: "Participant identification is required!"}
+	ErrRateLimited                  = &Error{Code: "rate_limited", Status: http.StatusTooManyRequests, Message: "Too many requests, slow down!"}
+	ErrRoomArchived                 = &Error{Code: "room_archived", Status: http.StatusConflict, Message: "This room is archived (read-only)!"}
+	ErrRoomClosed                   = &Error{Code: "room_closed", Status: http.StatusConflict, Message: "This room is closed to new questions and reactions!"}
+	ErrRoomNotFound                 = &Error{Code: "room_not_found", Status: http.StatusNotFound, Message: "Room not found!"}
+	ErrRouteNotFound                = &Error{Code: "route_not_found", Status: http.StatusNotFound, Message: "Route not found!"}
+	ErrShuttingDown                 = &Error{Code: "shutting_down", Status: http.StatusServiceUnavailable, Message: "Server is shutting down, try again shortly!"}
+	ErrSomethingWentWrong           = &Error{Code: "internal_error", Status: http.StatusInternalServerError, Message: "Something went wrong!"}
+	ErrUnknownCommand               = &Error{Code: "unknown_command", Status: http.StatusBadRequest, Message: "Unknown command!"}
+	ErrUpgradeToWebsocketConnection = &Error{Code: "websocket_upgrade_failed", Status: http.StatusBadRequest, Message: "Failed to upgrade to Websocket connection"}
+)
+
+// LOG MESSAGES
+// Ps: internal failures are only logged; clients get ErrSomethingWentWrong
 const (
-	ErrFailedToGetRoomMessage       = "Failed to get room message!"
-	ErrFailedToGetRoomMessages      = "Failed to get room messages!"
-	ErrFailedToGetRoom              = "Failed to get room!"
-	ErrFailedToGetRooms             = "Failed to get rooms!"
-	ErrFailedToInsertMessage        = "Failed to insert message!"
-	ErrFailedToMarkAsAnswered       = "Failed to mark message as answered!"
-	ErrFailedToReactToMessage       = "Failed to react to message!"
-	ErrFailedToRegisterRoom         = "Failed to register room!"
-	ErrFailedToRemoveReaction       = "Failed to remove reaction from message!"
-	ErrFailedToReturnRegisteredRoom = "Failed to return registered room!"
-	ErrFailedToNotifyClient         = "Failed to send message to client!"
-	ErrInvalidJSON                  = "Invalid JSON!"
-	ErrInvalidMessageID             = "Invalid message id!"
-	ErrInvalidRoomID                = "Invalid room id!"
-	ErrMessageNotFound              = "Message not found!"
-	ErrRoomNotFound                 = "Room not found!"
-	ErrSomethingWentWrong           = "Something went wrong!"
-	ErrUpgradeToWebsocketConnection = "Failed to upgrade to Websocket connection"
+	LogFailedToDeleteAnswer         = "Failed to delete answer!"
+	LogFailedToDeleteMessage        = "Failed to delete message!"
+	LogFailedToGetAnswers           = "Failed to get answers!"
+	LogFailedToGetReactions         = "Failed to get reactions!"
+	LogFailedToGetPendingMessages   = "Failed to get pending messages!"
+	LogFailedToGetReplies           = "Failed to get replies!"
+	LogFailedToGetRoomMessage       = "Failed to get room message!"
+	LogFailedToGetRoomMessages      = "Failed to get room messages!"
+	LogFailedToGetRoom              = "Failed to get room!"
+	LogFailedToGetRooms             = "Failed to get rooms!"
+	LogFailedToInsertAnswer         = "Failed to insert answer!"
+	LogFailedToInsertReply          = "Failed to insert reply!"
+	LogFailedToInsertMessage        = "Failed to insert message!"
+	LogFailedToMarkAsAnswered       = "Failed to mark message as answered!"
+	LogFailedToModerateMessage      = "Failed to moderate message!"
+	LogFailedToReactToMessage       = "Failed to react to message!"
+	LogFailedToRegisterRoom         = "Failed to register room!"
+	LogFailedToRemoveReaction       = "Failed to remove reaction from message!"
+	LogFailedToUpdateAnswer         = "Failed to update answer!"
+	LogFailedToUpdateRoomModeration = "Failed to update room moderation!"
+	LogFailedToUpdateRoomStatus     = "Failed to update room status!"
+	LogFailedToReturnResponse       = "Failed to return response!"
+	LogFailedToNotifyClient         = "Failed to send message to client!"
+	LogFailedToPublishMessage       = "Failed to publish message to room!"
+	LogFailedToRecordRoomEvent      = "Failed to record room event!"
+	LogFailedToReplayRoomEvents     = "Failed to replay room events!"
+	LogFailedToListenRoomEvents     = "Failed to listen room events!"
+	LogInvalidParticipantToken      = "Invalid participant token!"
+	LogInvalidRoomEvent             = "Invalid room event!"
+	LogPanicRecovered               = "Panic recovered!"
+	LogSubscriberDisconnected       = "Subscriber disconnected unexpectedly!"
+	LogSubscriberQueueFull          = "Subscriber send queue is full!"
+	LogUpgradeToWebsocketConnection = "Failed to upgrade to Websocket connection"
 )
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MESSAGE FILTERS
+// Text written by participants (questions over REST and websocket, replies) goes through
+// every filter before it is stored
+// Ps1: reject => the write fails with ErrMessageRejected and the reason as detail
+// Ps2: flag => the question waits for the host approval, as on moderated rooms
+// (replies have no moderation queue, so a flagged reply is rejected)
+// Ps3: answers are written by the host and are not filtered
+
+// FilterVerdict is what a filter decided about a text
+type FilterVerdict int
+
+const (
+	// FilterAllow lets the text through
+	FilterAllow FilterVerdict = iota
+	// FilterFlag holds the text for the host approval
+	FilterFlag
+	// FilterReject refuses the text
+	FilterReject
+)
+
+// FilterResult: verdict + reason shown to the client (empty when allowed)
+type FilterResult struct {
+	Verdict FilterVerdict
+	Reason  string
+}
+
+// MessageFilter inspects a text before it is stored
+// Ps: filters run on the request path, so they must be fast and safe for concurrent use
+type MessageFilter interface {
+	Filter(ctx context.Context, text string) FilterResult
+}
+
+// MessageFilterFunc adapts a function to MessageFilter
+type MessageFilterFunc func(ctx context.Context, text string) FilterResult
+
+func (filter MessageFilterFunc) Filter(ctx context.Context, text string) FilterResult {
+	return filter(ctx, text)
+}
+
+// defaultMaxMessageLength: messages.message and replies.reply are VARCHAR(255)
+const defaultMaxMessageLength = 255
+
+// WithMessageFilters replaces the default filters (max length only)
+// Ps: keep a max length filter in the list, longer texts are refused by the database
+func WithMessageFilters(filters ...MessageFilter) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.messageFilters = append([]MessageFilter{}, filters...)
+	}
+}
+
+// (a) FILTER MESSAGE
+// Run every filter: the first reject wins, otherwise the first flag
+func (apiHandler apiHandler) filterMessage(ctx context.Context, text string) FilterResult {
+	var result FilterResult
+	for _, filter := range apiHandler.messageFilters {
+		switch current := filter.Filter(ctx, text); current.Verdict {
+		case FilterReject:
+			return current
+		case FilterFlag:
+			if result.Verdict == FilterAllow {
+				result = current
+			}
+		}
+	}
+
+	return result
+}
+
+// (b) REJECTED MESSAGE
+// ErrMessageRejected carrying the reason given by the filter
+func rejectedMessage(result FilterResult) error {
+	rejected := *ErrMessageRejected
+	if result.Reason != "" {
+		rejected.Message = result.Reason
+	}
+
+	return &rejected
+}
+
+// (c) BUILT-IN FILTERS
+// i. Max length (in characters, like VARCHAR(n))
+func NewMaxLengthFilter(max int) MessageFilter {
+	reason := fmt.Sprintf("Message is too long (max %d characters)!", max)
+
+	return MessageFilterFunc(func(_ context.Context, text string) FilterResult {
+		if utf8.RuneCountInString(text) > max {
+			return FilterResult{Verdict: FilterReject, Reason: reason}
+		}
+		return FilterResult{}
+	})
+}
+
+// ii. Word list (case insensitive, whole words)
+// Ps: the reason does not name the word (lists may hold internal names)
+func NewWordListFilter(words []string, verdict FilterVerdict) MessageFilter {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return MessageFilterFunc(func(context.Context, string) FilterResult { return FilterResult{} })
+	}
+
+	return NewRegexFilter(RegexRule{
+		Pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+		Verdict: verdict,
+		Reason:  "Message contains a filtered word!",
+	})
+}
+
+// iii. Regex rules (checked in order, the first match decides)
+type RegexRule struct {
+	Pattern *regexp.Regexp
+	Verdict FilterVerdict
+	Reason  string
+}
+
+func NewRegexFilter(rules ...RegexRule) MessageFilter {
+	return MessageFilterFunc(func(_ context.Context, text string) FilterResult {
+		for _, rule := range rules {
+			if rule.Pattern.MatchString(text) {
+				return FilterResult{Verdict: rule.Verdict, Reason: rule.Reason}
+			}
+		}
+		return FilterResult{}
+	})
+}
+
+// iv. Links (scheme://... or www....)
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.)\S+`)
+
+func NewLinkFilter(verdict FilterVerdict) MessageFilter {
+	return NewRegexFilter(RegexRule{
+		Pattern: linkPattern,
+		Verdict: verdict,
+		Reason:  "Message contains a link!",
+	})
+}
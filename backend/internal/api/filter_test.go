@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+// FILTER TESTS
+
+// (a) BUILT-IN FILTERS
+func TestMessageFilters(t *testing.T) {
+	words := api.NewWordListFilter([]string{" spoiler ", ""}, api.FilterReject)
+	flaggedWords := api.NewWordListFilter([]string{"deadline"}, api.FilterFlag)
+	links := api.NewLinkFilter(api.FilterFlag)
+	regex := api.NewRegexFilter(
+		api.RegexRule{Pattern: regexp.MustCompile(`\d{4}-\d{4}`), Verdict: api.FilterReject, Reason: "card"},
+		api.RegexRule{Pattern: regexp.MustCompile(`\d+`), Verdict: api.FilterFlag, Reason: "number"},
+	)
+	maxLength := api.NewMaxLengthFilter(5)
+
+	tests := []struct {
+		name    string
+		filter  api.MessageFilter
+		text    string
+		verdict api.FilterVerdict
+		reason  string
+	}{
+		{"word rejected", words, "no spoiler please", api.FilterReject, "Message contains a filtered word!"},
+		{"word any case", words, "No SPOILER please", api.FilterReject, "Message contains a filtered word!"},
+		{"word at the edges", words, "spoiler", api.FilterReject, "Message contains a filtered word!"},
+		{"word next to punctuation", words, "is it a spoiler?", api.FilterReject, "Message contains a filtered word!"},
+		{"word inside another word", words, "spoilers ahead", api.FilterAllow, ""},
+		{"word flagged", flaggedWords, "what is the Deadline", api.FilterFlag, "Message contains a filtered word!"},
+		{"no words", api.NewWordListFilter([]string{" ", ""}, api.FilterReject), "anything", api.FilterAllow, ""},
+		{"link with scheme", links, "see https://example.com/a", api.FilterFlag, "Message contains a link!"},
+		{"link any scheme", links, "FTP://files.example.com", api.FilterFlag, "Message contains a link!"},
+		{"link with www", links, "go to www.example.com", api.FilterFlag, "Message contains a link!"},
+		{"domain without scheme", links, "what about example.com", api.FilterAllow, ""},
+		{"scheme alone", links, "the https:// prefix", api.FilterAllow, ""},
+		{"regex first rule", regex, "1234-5678", api.FilterReject, "card"},
+		{"regex next rule", regex, "call 42", api.FilterFlag, "number"},
+		{"regex no match", regex, "no digits", api.FilterAllow, ""},
+		{"length in characters", maxLength, "ééééé", api.FilterAllow, ""},
+		{"too long", maxLength, "éééééé", api.FilterReject, "Message is too long (max 5 characters)!"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.filter.Filter(context.Background(), test.text)
+			if result.Verdict != test.verdict || result.Reason != test.reason {
+				t.Fatalf("Filter(%q) = %+v, want %v %q", test.text, result, test.verdict, test.reason)
+			}
+		})
+	}
+}
+
+// (b) HANDLERS
+// The first reject wins over any flag; rejected messages are never stored
+func TestFilteredMessages(t *testing.T) {
+	server := newTestServer(t, api.WithMessageFilters(
+		api.NewMaxLengthFilter(255),
+		api.NewLinkFilter(api.FilterFlag),
+		api.NewWordListFilter([]string{"spoiler"}, api.FilterReject),
+	))
+	roomID, hostSecret := createRoom(t, server)
+	path := "/api/rooms/" + roomID + "/messages/"
+
+	for _, text := range []string{"spoiler at https://example.com", strings.Repeat("a", 256)} {
+		resp, data := doRequest(t, server, http.MethodPost, path, `{"message":"`+text+`"}`, nil)
+		expectProblem(t, resp, data, http.StatusUnprocessableEntity, api.ErrMessageRejected.Code)
+	}
+
+	resp, data := doRequest(t, server, http.MethodPost, path, `{"message":"spoiler"}`, nil)
+	expectProblem(t, resp, data, http.StatusUnprocessableEntity, api.ErrMessageRejected.Code)
+	if detail := decode[struct {
+		Detail string `json:"detail"`
+	}](t, data).Detail; detail != "Message contains a filtered word!" {
+		t.Fatalf("detail = %q", detail)
+	}
+
+	// Ps: flagged messages wait for the host, even in a room that is not moderated
+	resp, data = doRequest(t, server, http.MethodPost, path, `{"message":"see www.example.com"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create message: %d %s", resp.StatusCode, data)
+	}
+	flagged := decode[api.CommandCreateMessageResult](t, data)
+	if flagged.Status != api.MessageStatusPending || flagged.Reason != "Message contains a link!" {
+		t.Fatalf("flagged = %+v", flagged)
+	}
+
+	resp, data = doRequest(t, server, http.MethodGet, path, "", nil)
+	if messages := decode[[]json.RawMessage](t, data); resp.StatusCode != http.StatusOK || len(messages) != 0 {
+		t.Fatalf("list messages: %d %s", resp.StatusCode, data)
+	}
+	resp, data = doRequest(t, server, http.MethodGet, path+"pending", "", hostHeader(hostSecret))
+	pending := decode[[]struct {
+		ID string `json:"id"`
+	}](t, data)
+	if resp.StatusCode != http.StatusOK || len(pending) != 1 || pending[0].ID != flagged.ID {
+		t.Fatalf("pending messages: %d %s", resp.StatusCode, data)
+	}
+}
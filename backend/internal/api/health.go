@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HEALTH
+// GET /healthz (liveness): the process is up and serving, nothing else is checked
+// GET /readyz (readiness): every check passes => 200, otherwise a 503 problem (ErrNotReady);
+// both with the detail of each check
+// Ps1: draining is always checked, so readiness fails as soon as Shutdown starts
+// Ps2: checks run in parallel, each within readinessCheckTimeout
+
+// readinessCheckTimeout: a check slower than this fails (probes usually time out after 1-5s)
+const readinessCheckTimeout = 2 * time.Second
+
+// Health status constants
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusFailing = "failing"
+)
+
+// ReadinessCheck: a dependency the instance needs before receiving traffic
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// WithReadinessChecks adds checks to /readyz (after draining)
+func WithReadinessChecks(checks ...ReadinessCheck) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.readinessChecks = append(apiHandler.readinessChecks, checks...)
+	}
+}
+
+// (a) BUILT-IN CHECKS
+// i. Database: the pool can reach PostgreSQL
+func NewDatabaseCheck(pool *pgxpool.Pool) ReadinessCheck {
+	return ReadinessCheck{Name: "database", Check: pool.Ping}
+}
+
+// ii. Migrations: the schema is at least at the version this binary was built for
+// Ps: a newer schema is fine, so old replicas keep serving while a rolling deploy migrates
+// (migrations must stay compatible with the previous release)
+func NewMigrationsCheck(pool *pgxpool.Pool) ReadinessCheck {
+	expected := pgstore.ExpectedSchemaVersion()
+
+	return ReadinessCheck{Name: "migrations", Check: func(ctx context.Context) error {
+		version, err := pgstore.SchemaVersion(ctx, pool)
+		if err != nil {
+			return err
+		}
+		return checkSchemaVersion(version, expected)
+	}}
+}
+
+func checkSchemaVersion(version, expected int32) error {
+	if version < expected {
+		return fmt.Errorf("schema at version %d, expected %d or later", version, expected)
+	}
+	return nil
+}
+
+// iii. Draining: Shutdown has not started
+func (apiHandler apiHandler) drainingCheck() ReadinessCheck {
+	return ReadinessCheck{Name: "draining", Check: func(context.Context) error {
+		if apiHandler.isDraining() {
+			return errors.New("shutting down")
+		}
+		return nil
+	}}
+}
+
+// (b) GET: handleLiveness
+func (apiHandler apiHandler) handleLiveness(respWriter http.ResponseWriter, req *http.Request) {
+	sendHealth(respWriter, healthResponse{Status: HealthStatusOK})
+}
+
+// (c) GET: handleReadiness
+func (apiHandler apiHandler) handleReadiness(respWriter http.ResponseWriter, req *http.Request) {
+	checks := append([]ReadinessCheck{apiHandler.drainingCheck()}, apiHandler.readinessChecks...)
+	results := make([]healthCheckResponse, len(checks))
+
+	wg := sync.WaitGroup{}
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runReadinessCheck(req.Context(), check)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != HealthStatusOK {
+			// Ps: probes and operators read the detail of each check
+			respWriter.Header().Set("Cache-Control", "no-store")
+			sendProblem(respWriter, ErrNotReady.Status, readinessProblem{problem: newProblem(req, ErrNotReady), Checks: results})
+			return
+		}
+	}
+
+	sendHealth(respWriter, healthResponse{Status: HealthStatusOK, Checks: results})
+}
+
+func runReadinessCheck(ctx context.Context, check ReadinessCheck) healthCheckResponse {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := healthCheckResponse{
+		Name:       check.Name,
+		Status:     HealthStatusOK,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status, result.Error = HealthStatusFailing, err.Error()
+	}
+
+	return result
+}
+
+// sendHealth: like sendJSON, but never cached by proxies
+func sendHealth(respWriter http.ResponseWriter, response healthResponse) {
+	data, _ := json.Marshal(response)
+
+	respWriter.Header().Set("Content-Type", "application/json")
+	respWriter.Header().Set("Cache-Control", "no-store")
+	if _, err := respWriter.Write(data); err != nil {
+		slog.Error(LogFailedToReturnResponse, "error", err)
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import "testing"
+
+// Internal test: replicas are ready on their schema version or a newer one (rolling deploys)
+func TestCheckSchemaVersion(t *testing.T) {
+	tests := []struct {
+		version, expected int32
+		ready             bool
+	}{
+		{version: 11, expected: 12, ready: false},
+		{version: 12, expected: 12, ready: true},
+		{version: 13, expected: 12, ready: true},
+	}
+
+	for _, test := range tests {
+		if err := checkSchemaVersion(test.version, test.expected); (err == nil) != test.ready {
+			t.Fatalf("version %d, expected %d: err = %v, want ready = %v", test.version, test.expected, err, test.ready)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// HOSTS
+// Whoever creates a room gets its host secret (returned once by POST /api/rooms);
+// host-only operations require it as "Authorization: Bearer <secret>"
+// Ps1: only the SHA-256 of the secret is stored (the secret is random, so a slow hash is not needed)
+// Ps2: websocket handshakes carry it as a subprotocol instead (see hostSecretProtocol)
+
+// hostSecretKey is the request context key holding the host secret sent by the client
+type hostSecretKey struct{}
+
+// (a) NEW HOST SECRET
+func newHostSecret() (secret string, hash []byte) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+
+	secret = base64.RawURLEncoding.EncodeToString(raw)
+	return secret, hashHostSecret(secret)
+}
+
+func hashHostSecret(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+// (b) RESOLVE HOST SECRET (middleware)
+// Store the host secret sent by the client on the request context (checked later against the room)
+func resolveHostSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		secret, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			secret = protocolCredential(req, hostSecretProtocol)
+		}
+
+		if secret != "" {
+			req = req.WithContext(context.WithValue(req.Context(), hostSecretKey{}, secret))
+		}
+
+		next.ServeHTTP(respWriter, req)
+	})
+}
+
+// (c) IS HOST
+// Report whether ctx carries the host secret of room
+func isHost(ctx context.Context, room pgstore.Room) bool {
+	secret, ok := ctx.Value(hostSecretKey{}).(string)
+	if !ok || len(room.HostSecretHash) == 0 {
+		return false
+	}
+
+	// Ps: constant time comparison
+	return subtle.ConstantTimeCompare(hashHostSecret(secret), room.HostSecretHash) == 1
+}
+
+// (d) REQUIRE HOST
+// Fail with ErrHostRequired unless ctx carries the host secret of roomID
+// Ps: archived rooms are read-only, even for the host (ErrRoomArchived)
+func (apiHandler apiHandler) requireHost(ctx context.Context, roomID uuid.UUID) (pgstore.Room, error) {
+	room, err := apiHandler.query.GetRoom(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pgstore.Room{}, ErrRoomNotFound
+		}
+
+		slog.Error(LogFailedToGetRoom, "error", err)
+		return pgstore.Room{}, ErrSomethingWentWrong
+	}
+
+	if !isHost(ctx, room) {
+		return pgstore.Room{}, ErrHostRequired
+	}
+	if room.Status == RoomStatusArchived {
+		return pgstore.Room{}, ErrRoomArchived
+	}
+
+	return room, nil
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+// open -> closed -> open -> archived, one room_status_changed event per actual change
+func TestRoomLifecycle(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	path := "/api/rooms/" + roomID
+	messageID := createMessage(t, server, roomID, "question")
+	participant := participantHeader(createParticipant(t, server))
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+
+	setStatus := func(action, want string) {
+		t.Helper()
+
+		resp, data := doRequest(t, server, http.MethodPatch, path+"/"+action, "", hostHeader(hostSecret))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %d %s", action, resp.StatusCode, data)
+		}
+		if status := decode[struct{ Status string }](t, data).Status; status != want {
+			t.Fatalf("%s: status = %q, want %q", action, status, want)
+		}
+	}
+
+	// expectWritesRefused: questions, reactions and replies all fail with code
+	expectWritesRefused := func(code string) {
+		t.Helper()
+
+		resp, data := doRequest(t, server, http.MethodPost, path+"/messages/", `{"message":"late question"}`, nil)
+		expectProblem(t, resp, data, http.StatusConflict, code)
+		resp, data = doRequest(t, server, http.MethodPatch, path+"/messages/"+messageID+"/react", "", participant)
+		expectProblem(t, resp, data, http.StatusConflict, code)
+		resp, data = doRequest(t, server, http.MethodPost, path+"/messages/"+messageID+"/replies/", `{"reply":"+1"}`, nil)
+		expectProblem(t, resp, data, http.StatusConflict, code)
+
+		// Ps: reads keep working
+		resp, data = doRequest(t, server, http.MethodGet, path+"/messages/"+messageID, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("get message: %d %s", resp.StatusCode, data)
+		}
+	}
+
+	for _, action := range []string{"close", "reopen", "archive"} {
+		for _, header := range []http.Header{nil, hostHeader("wrong")} {
+			resp, data := doRequest(t, server, http.MethodPatch, path+"/"+action, "", header)
+			expectProblem(t, resp, data, http.StatusForbidden, api.ErrHostRequired.Code)
+		}
+	}
+
+	// i. Closed: no new questions, reactions nor replies
+	setStatus("close", api.RoomStatusClosed)
+	setStatus("close", api.RoomStatusClosed)
+	expectWritesRefused(api.ErrRoomClosed.Code)
+
+	// ii. Reopened: writes are accepted again
+	setStatus("reopen", api.RoomStatusOpen)
+	reopened := createMessage(t, server, roomID, "another question")
+
+	// iii. Archived: read-only and no longer listed
+	setStatus("archive", api.RoomStatusArchived)
+	expectWritesRefused(api.ErrRoomArchived.Code)
+
+	if ids := getIDs(t, server, "/api/rooms/"); slices.Contains(ids, roomID) {
+		t.Fatalf("archived room listed: %v", ids)
+	}
+	resp, data := doRequest(t, server, http.MethodGet, path, "", nil)
+	if status := decode[struct{ Status string }](t, data).Status; resp.StatusCode != http.StatusOK || status != api.RoomStatusArchived {
+		t.Fatalf("get room: %d %s", resp.StatusCode, data)
+	}
+
+	// Ps: closing twice and the refused writes sent nothing
+	want := []struct{ kind, value string }{
+		{api.MessageKindRoomStatusChanged, `{"status":"closed"}`},
+		{api.MessageKindRoomStatusChanged, `{"status":"open"}`},
+		{api.MessageKindMessageCreated, `{"id":"` + reopened + `","message":"another question"}`},
+		{api.MessageKindRoomStatusChanged, `{"status":"archived"}`},
+	}
+	for _, event := range want {
+		got := readEvent(t, conn)
+		if got.Kind != event.kind || string(got.Value) != event.value {
+			t.Fatalf("event = %s %s, want %s %s", got.Kind, got.Value, event.kind, event.value)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// METRICS
+// GET /metrics exposes them in the Prometheus text format (scraped, nothing is pushed)
+// Ps1: HTTP metrics are labeled by chi route pattern (/api/rooms/{room_id}/...), never by raw path
+// Ps2: rooms are not a label (one series per room would grow forever): subscribers per room
+// are observed as a distribution at every fan-out instead
+
+const metricsNamespace = "wsrs"
+
+// metrics holds every collector of a handler
+type metrics struct {
+	registry *prometheus.Registry
+	// (a) HTTP
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	// (b) Websocket subscribers
+	subscribers        prometheus.Gauge
+	subscribedRooms    prometheus.Gauge
+	writeFailures      prometheus.Counter
+	droppedMessages    *prometheus.CounterVec
+	fanoutDuration     prometheus.Histogram
+	fanoutSubscribers  prometheus.Histogram
+	broadcastDuration  prometheus.Histogram
+	broadcastPublished *prometheus.CounterVec
+}
+
+// WithMetricsRegistry registers the handler metrics on registry (so the caller can add its own,
+// e.g. NewPoolCollector) and serves it on /metrics
+// Ps: by default each handler has its own NewMetricsRegistry
+func WithMetricsRegistry(registry *prometheus.Registry) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.metrics = newMetrics(registry)
+	}
+}
+
+// NewMetricsRegistry: an empty registry plus the Go runtime and process collectors
+func NewMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return registry
+}
+
+func newMetrics(registry *prometheus.Registry) *metrics {
+	m := &metrics{
+		registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern (websocket subscriptions excluded).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		subscribers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_subscribers",
+			Help:      "Websocket subscribers connected to this instance.",
+		}),
+		subscribedRooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_rooms",
+			Help:      "Rooms with at least one subscriber on this instance.",
+		}),
+		writeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_write_failures_total",
+			Help:      "Messages or pings that could not be written to a subscriber (the subscriber is dropped).",
+		}),
+		droppedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "websocket_dropped_messages_total",
+			Help:      "Messages not delivered because a subscriber send queue was full, by overflow policy.",
+		}, []string{"policy"}),
+		fanoutDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fanout_duration_seconds",
+			Help:      "Time to queue a room event for every local subscriber of the room.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+		fanoutSubscribers: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fanout_subscribers",
+			Help:      "Local subscribers reached by a room event.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		broadcastDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "broadcast_duration_seconds",
+			Help:      "Time to record a room event and publish it through the broadcaster.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		broadcastPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "broadcast_events_total",
+			Help:      "Room events published, by kind.",
+		}, []string{"kind"}),
+	}
+
+	registry.MustRegister(
+		m.httpRequests, m.httpRequestDuration,
+		m.subscribers, m.subscribedRooms, m.writeFailures, m.droppedMessages,
+		m.fanoutDuration, m.fanoutSubscribers, m.broadcastDuration, m.broadcastPublished,
+	)
+
+	return m
+}
+
+// (a) GET: handleMetrics
+func (apiHandler apiHandler) handleMetrics(respWriter http.ResponseWriter, req *http.Request) {
+	promhttp.HandlerFor(apiHandler.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(respWriter, req)
+}
+
+// (b) INSTRUMENT (middleware)
+// Count and time every request by route pattern
+func (apiHandler apiHandler) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(respWriter, req.ProtoMajor)
+
+		next.ServeHTTP(wrapped, req)
+
+		// Ps: the pattern is only complete once the router has matched the request
+		route := chi.RouteContext(req.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		// Ps: upgraded connections are hijacked (nothing written through the wrapper) and
+		// last as long as the subscription, so they are counted but not timed
+		status := wrapped.Status()
+		if status == 0 && websocket.IsWebSocketUpgrade(req) {
+			apiHandler.metrics.httpRequests.WithLabelValues(req.Method, route, strconv.Itoa(http.StatusSwitchingProtocols)).Inc()
+			return
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		apiHandler.metrics.httpRequests.WithLabelValues(req.Method, route, strconv.Itoa(status)).Inc()
+		apiHandler.metrics.httpRequestDuration.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// (c) POOL COLLECTOR
+// pgxpool statistics, read on every scrape
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+}
+
+// NewPoolCollector exposes the statistics of pool (register it with WithMetricsRegistry)
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		pool:                 pool,
+		acquiredConns:        desc("acquired_connections", "Connections currently in use."),
+		idleConns:            desc("idle_connections", "Connections currently idle."),
+		totalConns:           desc("total_connections", "Connections currently open (acquired, idle and being opened)."),
+		maxConns:             desc("max_connections", "Maximum size of the pool."),
+		acquireCount:         desc("acquires_total", "Successful connection acquisitions."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquireCount:    desc("empty_acquires_total", "Acquisitions that had to wait because the pool was empty."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Acquisitions canceled by their context."),
+	}
+}
+
+func (collector *poolCollector) Describe(descs chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(collector, descs)
+}
+
+func (collector *poolCollector) Collect(metrics chan<- prometheus.Metric) {
+	stat := collector.pool.Stat()
+
+	metrics <- prometheus.MustNewConstMetric(collector.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(collector.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	metrics <- prometheus.MustNewConstMetric(collector.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(collector.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// HTTP series are labeled by route pattern, and the subscriber gauges follow the connections
+func TestMetrics(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	for i := 0; i < 2; i++ {
+		doRequest(t, server, http.MethodGet, "/api/rooms/"+roomID, "", nil)
+	}
+	doRequest(t, server, http.MethodGet, "/api/rooms/00000000-0000-0000-0000-000000000000", "", nil)
+	doRequest(t, server, http.MethodGet, "/api/unknown/"+roomID, "", nil)
+
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+	createMessage(t, server, roomID, "question")
+
+	// i. While subscribed
+	body := getMetrics(t, server)
+	expectMetrics(t, body,
+		`wsrs_http_requests_total{method="GET",route="/api/rooms/{room_id}",status="200"} 2`,
+		`wsrs_http_requests_total{method="GET",route="/api/rooms/{room_id}",status="404"} 1`,
+		`wsrs_http_requests_total{method="POST",route="/api/rooms/{room_id}/messages",status="200"} 1`,
+		`wsrs_http_requests_total{method="GET",route="/api/*",status="404"} 1`,
+		`wsrs_http_request_duration_seconds_count{method="GET",route="/api/rooms/{room_id}"} 3`,
+		`wsrs_websocket_subscribers 1`,
+		`wsrs_websocket_rooms 1`,
+		`wsrs_broadcast_events_total{kind="message_created"} 1`,
+		`wsrs_fanout_subscribers_count 1`,
+		`go_goroutines `,
+	)
+
+	// Ps: a raw path would make one series per room
+	if strings.Contains(body, roomID) {
+		t.Fatalf("room id %s used as a label:\n%s", roomID, body)
+	}
+
+	// ii. Once the subscriber is gone (the subscription is counted when it ends)
+	conn.Close()
+	subscription := `wsrs_http_requests_total{method="GET",route="/subscribe/{room_id}",status="101"} 1`
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(body, "\n"+subscription) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		body = getMetrics(t, server)
+	}
+	expectMetrics(t, body,
+		subscription,
+		`wsrs_websocket_subscribers 0`,
+		`wsrs_websocket_rooms 0`,
+	)
+}
+
+func getMetrics(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+
+	resp, data := doRequest(t, server, http.MethodGet, "/metrics", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("metrics: %d %s", resp.StatusCode, data)
+	}
+
+	return string(data)
+}
+
+// expectMetrics fails unless body has a line starting with each prefix
+func expectMetrics(t *testing.T, body string, prefixes ...string) {
+	t.Helper()
+
+	for _, prefix := range prefixes {
+		if !strings.Contains(body, "\n"+prefix) {
+			t.Fatalf("missing %q in:\n%s", prefix, body)
+		}
+	}
+}
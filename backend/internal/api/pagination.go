@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+// PAGINATION
+// GET /api/rooms and GET /api/rooms/{room_id}/messages return one page at a time
+// Ps1: ?limit=N (default 50, max 100), ?sort=MODE and ?cursor=CURSOR
+// Ps2: when there is a next page, its cursor is sent on "X-Next-Cursor" and its
+// full URL on "Link: <URL>; rel="next""
+// Ps3: the cursor is opaque to clients: base64url(JSON) of the sort keys of the last item sent
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+	// nextCursorHeader carries the cursor of the next page
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// Sort modes (?sort=)
+const (
+	SortNewest          = "newest"
+	SortMostReacted     = "most_reacted"
+	SortUnansweredFirst = "unanswered_first"
+)
+
+// pageCursor: position after the last item of a page
+// Ps: Sort is kept so a cursor cannot be reused with another sort mode
+type pageCursor struct {
+	Sort          string    `json:"sort"`
+	CreatedAt     time.Time `json:"created_at"`
+	ID            uuid.UUID `json:"id"`
+	ReactionCount int64     `json:"reaction_count,omitempty"`
+	Answered      bool      `json:"answered,omitempty"`
+}
+
+// page: what the client asked for
+type page struct {
+	sort      string
+	limit     int32
+	hasCursor bool
+	cursor    pageCursor
+}
+
+// (a) READ PAGE
+// Parse limit, sort and cursor from the query string (the first of sorts is the default)
+func readPage(respWriter http.ResponseWriter, req *http.Request, sorts ...string) (p page, ok bool) {
+	query := req.URL.Query()
+
+	p.sort = sorts[0]
+	if rawSort := query.Get("sort"); rawSort != "" {
+		if !slices.Contains(sorts, rawSort) {
+			sendError(respWriter, req, ErrInvalidSort)
+			return page{}, false
+		}
+		p.sort = rawSort
+	}
+
+	p.limit = defaultPageLimit
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			sendError(respWriter, req, ErrInvalidLimit)
+			return page{}, false
+		}
+		p.limit = int32(limit)
+	}
+
+	if rawCursor := query.Get("cursor"); rawCursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(rawCursor)
+		if err != nil || json.Unmarshal(data, &p.cursor) != nil || p.cursor.Sort != p.sort {
+			sendError(respWriter, req, ErrInvalidCursor)
+			return page{}, false
+		}
+		p.hasCursor = true
+	}
+
+	return p, true
+}
+
+// (b) SET NEXT PAGE
+// Advertise the page that starts after next (must run before the body is written)
+func setNextPage(respWriter http.ResponseWriter, req *http.Request, p page, next pageCursor) {
+	next.Sort = p.sort
+	data, err := json.Marshal(next)
+	if err != nil {
+		return
+	}
+	cursor := base64.RawURLEncoding.EncodeToString(data)
+
+	query := req.URL.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(int(p.limit)))
+	query.Set("sort", p.sort)
+
+	respWriter.Header().Set(nextCursorHeader, cursor)
+	respWriter.Header().Set("Link", "<"+req.URL.Path+"?"+query.Encode()+">; rel=\"next\"")
+}
+
+// (c) PAGES
+// i. Rooms (newest first)
+// Ps: one extra row is fetched to know whether there is a next page
+func (apiHandler apiHandler) getRoomsPage(ctx context.Context, p page) ([]pgstore.Room, bool, error) {
+	rooms, err := apiHandler.query.GetRoomsPage(ctx, pgstore.GetRoomsPageParams{
+		HasCursor:       p.hasCursor,
+		CursorCreatedAt: p.cursor.CreatedAt,
+		CursorID:        p.cursor.ID,
+		PageLimit:       p.limit + 1,
+	})
+	if err != nil || len(rooms) <= int(p.limit) {
+		return rooms, false, err
+	}
+
+	return rooms[:p.limit], true, nil
+}
+
+// ii. Room messages (one query per sort mode)
+func (apiHandler apiHandler) getRoomMessagesPage(ctx context.Context, roomID uuid.UUID, p page) ([]pgstore.Message, bool, error) {
+	var messages []pgstore.Message
+	var err error
+
+	switch p.sort {
+	case SortMostReacted:
+		messages, err = apiHandler.query.GetRoomMessagesMostReacted(ctx, pgstore.GetRoomMessagesMostReactedParams{
+			RoomID:              roomID,
+			HasCursor:           p.hasCursor,
+			CursorReactionCount: p.cursor.ReactionCount,
+			CursorCreatedAt:     p.cursor.CreatedAt,
+			CursorID:            p.cursor.ID,
+			PageLimit:           p.limit + 1,
+		})
+	case SortUnansweredFirst:
+		messages, err = apiHandler.query.GetRoomMessagesUnansweredFirst(ctx, pgstore.GetRoomMessagesUnansweredFirstParams{
+			RoomID:          roomID,
+			HasCursor:       p.hasCursor,
+			CursorAnswered:  p.cursor.Answered,
+			CursorCreatedAt: p.cursor.CreatedAt,
+			CursorID:        p.cursor.ID,
+			PageLimit:       p.limit + 1,
+		})
+	default:
+		messages, err = apiHandler.query.GetRoomMessagesNewest(ctx, pgstore.GetRoomMessagesNewestParams{
+			RoomID:          roomID,
+			HasCursor:       p.hasCursor,
+			CursorCreatedAt: p.cursor.CreatedAt,
+			CursorID:        p.cursor.ID,
+			PageLimit:       p.limit + 1,
+		})
+	}
+	if err != nil || len(messages) <= int(p.limit) {
+		return messages, false, err
+	}
+
+	return messages[:p.limit], true, nil
+}
+
+// (d) CURSORS
+func roomCursor(room pgstore.Room) pageCursor {
+	return pageCursor{CreatedAt: room.CreatedAt, ID: room.ID}
+}
+
+// Ps: reaction counts keep changing, so most_reacted pages may repeat or skip a message
+// that gained or lost reactions in between
+func messageCursor(message pgstore.Message) pageCursor {
+	return pageCursor{
+		CreatedAt:     message.CreatedAt,
+		ID:            message.ID,
+		ReactionCount: message.ReactionCount,
+		Answered:      message.Answered,
+	}
+}
@@ -0,0 +1,201 @@
+package api_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+// pageItem: the fields of rooms and messages the pagination tests look at
+type pageItem struct {
+	ID            string `json:"id"`
+	ReactionCount int64  `json:"reaction_count"`
+	Answered      bool   `json:"answered"`
+}
+
+// getAllPages follows the Link header from path and returns every item, page by page
+// Ps: every page but the last has a Link and an X-Next-Cursor; the last has neither
+func getAllPages(t *testing.T, server *httptest.Server, path string) [][]pageItem {
+	t.Helper()
+
+	var pages [][]pageItem
+	for path != "" {
+		resp, data := doRequest(t, server, http.MethodGet, path, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("get %s: %d %s", path, resp.StatusCode, data)
+		}
+		pages = append(pages, decode[[]pageItem](t, data))
+
+		cursor, link := resp.Header.Get("X-Next-Cursor"), resp.Header.Get("Link")
+		if (cursor == "") != (link == "") {
+			t.Fatalf("X-Next-Cursor = %q but Link = %q", cursor, link)
+		}
+
+		path = ""
+		if link != "" {
+			rawURL, ok := strings.CutSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			next, err := url.Parse(rawURL)
+			if !ok || err != nil || next.Query().Get("cursor") != cursor {
+				t.Fatalf("Link = %q (cursor %q)", link, cursor)
+			}
+			path = next.RequestURI()
+		}
+	}
+
+	return pages
+}
+
+// getIDs returns the ids of a single page (limit 100, no cursor)
+func getIDs(t *testing.T, server *httptest.Server, path string) []string {
+	t.Helper()
+
+	pages := getAllPages(t, server, path)
+	if len(pages) != 1 {
+		t.Fatalf("get %s: %d pages, want 1", path, len(pages))
+	}
+	return itemIDs(pages[0])
+}
+
+func itemIDs(items []pageItem) []string {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+// Pages of 3 cover the 7 messages once each, in the order of a single page
+func TestMessagesPagination(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	var created []string
+	for i := 0; i < 7; i++ {
+		created = append(created, createMessage(t, server, roomID, "question"))
+	}
+
+	// Ps: 3 messages get reactions (1, 2 and 1) and 2 are answered, so every sort reorders them
+	for _, messageID := range []string{created[1], created[4], created[4], created[6]} {
+		resp, data := doRequest(t, server, http.MethodPatch, "/api/rooms/"+roomID+"/messages/"+messageID+"/react", "", participantHeader(createParticipant(t, server)))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("react: %d %s", resp.StatusCode, data)
+		}
+	}
+	for _, messageID := range []string{created[0], created[6]} {
+		resp, data := doRequest(t, server, http.MethodPatch, "/api/rooms/"+roomID+"/messages/"+messageID+"/answer", "", hostHeader(hostSecret))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("answer: %d %s", resp.StatusCode, data)
+		}
+	}
+
+	for _, sort := range []string{api.SortNewest, api.SortMostReacted, api.SortUnansweredFirst} {
+		t.Run(sort, func(t *testing.T) {
+			path := "/api/rooms/" + roomID + "/messages/?sort=" + sort
+			want := getIDs(t, server, path+"&limit=100")
+
+			pages := getAllPages(t, server, path+"&limit=3")
+			if len(pages) != 3 || len(pages[0]) != 3 || len(pages[1]) != 3 || len(pages[2]) != 1 {
+				t.Fatalf("page sizes = %v", pages)
+			}
+
+			var items []pageItem
+			for _, page := range pages {
+				items = append(items, page...)
+			}
+			if got := itemIDs(items); !slices.Equal(got, want) {
+				t.Fatalf("paginated = %v, single page = %v", got, want)
+			}
+			sorted := slices.Clone(want)
+			slices.Sort(sorted)
+			expected := slices.Clone(created)
+			slices.Sort(expected)
+			if !slices.Equal(sorted, expected) {
+				t.Fatalf("messages = %v, want %v", want, created)
+			}
+
+			// Ps: the order of each sort mode
+			for i := 1; i < len(items); i++ {
+				previous, current := items[i-1], items[i]
+				switch sort {
+				case api.SortNewest:
+					if slices.Index(created, previous.ID) < slices.Index(created, current.ID) {
+						t.Fatalf("%s listed before the newer %s", previous.ID, current.ID)
+					}
+				case api.SortMostReacted:
+					if previous.ReactionCount < current.ReactionCount {
+						t.Fatalf("reaction counts not decreasing: %+v", items)
+					}
+				case api.SortUnansweredFirst:
+					if previous.Answered && !current.Answered {
+						t.Fatalf("answered before unanswered: %+v", items)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Rooms are paginated the same way (newest first)
+func TestRoomsPagination(t *testing.T) {
+	server := newTestServer(t)
+	var created []string
+	for i := 0; i < 5; i++ {
+		roomID, _ := createRoom(t, server)
+		created = append([]string{roomID}, created...)
+	}
+
+	var got []string
+	for _, page := range getAllPages(t, server, "/api/rooms/?limit=2") {
+		got = append(got, itemIDs(page)...)
+	}
+	if !slices.Equal(got, created) {
+		t.Fatalf("rooms = %v, want %v", got, created)
+	}
+
+	// Ps: exactly one full page has no next page
+	if pages := getAllPages(t, server, "/api/rooms/?limit=5"); len(pages) != 1 {
+		t.Fatalf("limit 5: %d pages, want 1", len(pages))
+	}
+}
+
+func TestInvalidPages(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	path := "/api/rooms/" + roomID + "/messages/"
+
+	// Ps: a valid newest cursor, reused with another sort
+	createMessage(t, server, roomID, "first")
+	createMessage(t, server, roomID, "second")
+	resp, _ := doRequest(t, server, http.MethodGet, path+"?limit=1", "", nil)
+	newestCursor := resp.Header.Get("X-Next-Cursor")
+	if newestCursor == "" {
+		t.Fatal("no next cursor")
+	}
+
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"?limit=0", api.ErrInvalidLimit.Code},
+		{"?limit=-1", api.ErrInvalidLimit.Code},
+		{"?limit=101", api.ErrInvalidLimit.Code},
+		{"?limit=ten", api.ErrInvalidLimit.Code},
+		{"?sort=oldest", api.ErrInvalidSort.Code},
+		{"?cursor=!!!", api.ErrInvalidCursor.Code},
+		{"?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("not json")), api.ErrInvalidCursor.Code},
+		{"?sort=most_reacted&cursor=" + newestCursor, api.ErrInvalidCursor.Code},
+	}
+	for _, test := range tests {
+		resp, data := doRequest(t, server, http.MethodGet, path+test.query, "", nil)
+		expectProblem(t, resp, data, http.StatusBadRequest, test.code)
+	}
+
+	// Ps: rooms only sort by newest
+	resp, data := doRequest(t, server, http.MethodGet, "/api/rooms/?sort=most_reacted", "", nil)
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidSort.Code)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PARTICIPANTS
+// A participant is whoever asks and votes in a room; reactions are kept per participant
+// Ps1: participants are anonymous: POST /api/participants issues an id plus a token
+// signed with HMAC-SHA256, so the id cannot be forged without the server secret
+// Ps2: token format = base64url(participant id) + "." + base64url(signature)
+
+// participantTokenHeader carries the token on REST requests
+// Ps: websocket handshakes carry it as a subprotocol (see participantTokenProtocol)
+const participantTokenHeader = "X-Participant-Token"
+
+// participantKey is the request context key holding the participant id
+type participantKey struct{}
+
+// WithParticipantSecret sets the key used to sign participant tokens
+// Ps: without it a random key is generated, so tokens stop working on restart
+func WithParticipantSecret(secret []byte) Option {
+	return func(apiHandler *apiHandler) {
+		if len(secret) > 0 {
+			apiHandler.participantSecret = secret
+		}
+	}
+}
+
+// newParticipantSecret generates a random signing key
+func newParticipantSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// (a) POST: handleCreateParticipant
+func (apiHandler apiHandler) handleCreateParticipant(respWriter http.ResponseWriter, req *http.Request) {
+	participantID := uuid.New()
+
+	// Response type to user
+	type response struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+
+	sendJSON(respWriter, req, response{ID: participantID.String(), Token: apiHandler.signParticipant(participantID)})
+}
+
+// (b) RESOLVE PARTICIPANT (middleware)
+// Verify the participant token sent by the client and store its id on the request context
+// Ps: requests without a token go on anonymously; an invalid token is rejected
+func (apiHandler apiHandler) resolveParticipant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		token := req.Header.Get(participantTokenHeader)
+		if token == "" {
+			token = protocolCredential(req, participantTokenProtocol)
+		}
+		if token == "" {
+			next.ServeHTTP(respWriter, req)
+			return
+		}
+
+		participantID, ok := apiHandler.verifyParticipant(token)
+		if !ok {
+			slog.Warn(LogInvalidParticipantToken, "client_ip", clientIPFromContext(req.Context()))
+			sendError(respWriter, req, ErrInvalidParticipantToken)
+			return
+		}
+
+		next.ServeHTTP(respWriter, req.WithContext(context.WithValue(req.Context(), participantKey{}, participantID)))
+	})
+}
+
+// (c) PARTICIPANT FROM CONTEXT
+func participantFromContext(ctx context.Context) (participantID uuid.UUID, ok bool) {
+	participantID, ok = ctx.Value(participantKey{}).(uuid.UUID)
+	return participantID, ok
+}
+
+// (d) SIGN / VERIFY TOKENS
+func (apiHandler apiHandler) signParticipant(participantID uuid.UUID) string {
+	payload := participantID[:]
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(apiHandler.participantSignature(payload))
+}
+
+func (apiHandler apiHandler) verifyParticipant(token string) (uuid.UUID, bool) {
+	rawPayload, rawSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.UUID{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(rawPayload)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(rawSignature)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+
+	// Ps: constant time comparison
+	if !hmac.Equal(signature, apiHandler.participantSignature(payload)) {
+		return uuid.UUID{}, false
+	}
+
+	participantID, err := uuid.FromBytes(payload)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+
+	return participantID, true
+}
+
+func (apiHandler apiHandler) participantSignature(payload []byte) []byte {
+	mac := hmac.New(sha256.New, apiHandler.participantSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// pgChannelPrefix + room id = PostgreSQL channel of a room (41 chars, below the 63 chars limit)
+	pgChannelPrefix = "room_"
+	// delay between reconnection attempts of the listener connection
+	pgListenRetryDelay = time.Second
+)
+
+// pgNotification is the payload sent through pg_notify (the room id travels on the channel name)
+// Ps: Traceparent (W3C trace context) links the spans of every instance to the broadcast span
+type pgNotification struct {
+	Kind        string          `json:"kind"`
+	Value       json.RawMessage `json:"value"`
+	Seq         int64           `json:"seq,omitempty"`
+	Traceparent string          `json:"traceparent,omitempty"`
+}
+
+// PGBroadcaster fans room events out across instances with PostgreSQL LISTEN/NOTIFY
+// Ps1: each room has its own channel; an instance only LISTENs on rooms it has subscribers for
+// Ps2: a single connection is taken out of the pool for LISTEN; it is re-established
+// (and every channel listened again) whenever it breaks
+// Ps3: room events are recorded and notified in one transaction (see RecordAndPublish)
+// Ps4: notifications sent while the connection is down are lost: the rooms it was listening
+// on are reported to the gap handler, whose subscribers resume with ?since=SEQ
+type PGBroadcaster struct {
+	pool    *pgxpool.Pool
+	receive func(Message)
+	gap     func(roomID string)
+
+	// mu protects the fields below
+	mu *sync.Mutex
+	// rooms the local subscribers are interested in (subscribers by room)
+	rooms map[string]int
+	// listening: rooms LISTEN is active for on the current connection
+	listening map[string]struct{}
+	// listeningChanged is closed (and replaced) whenever listening changes
+	listeningChanged chan struct{}
+	// cancelWait interrupts WaitForNotification so the listener can apply changes on rooms
+	cancelWait context.CancelFunc
+}
+
+// Compile-time checks: PGBroadcaster records its own events and reports the lost ones
+var (
+	_ EventRecorder = (*PGBroadcaster)(nil)
+	_ GapReporter   = (*PGBroadcaster)(nil)
+)
+
+// NewPGBroadcaster creates a broadcaster on top of pool and starts listening until ctx is done
+func NewPGBroadcaster(ctx context.Context, pool *pgxpool.Pool) *PGBroadcaster {
+	broadcaster := &PGBroadcaster{
+		pool:             pool,
+		mu:               &sync.Mutex{},
+		rooms:            make(map[string]int),
+		listening:        make(map[string]struct{}),
+		listeningChanged: make(chan struct{}),
+	}
+
+	go broadcaster.run(ctx)
+
+	return broadcaster
+}
+
+func (broadcaster *PGBroadcaster) Publish(ctx context.Context, msg Message) error {
+	return notify(ctx, broadcaster.pool, msg)
+}
+
+// RecordAndPublish inserts msg into room_events and notifies it in the same transaction
+// Ps1: InsertRoomEvent locks the room row until commit, so the transactions of a room commit in
+// sequence order, and PostgreSQL delivers notifications in commit order: every instance
+// receives seq N before seq N+1, whichever replica published them
+// Ps2: notifying after the commit (in another statement) could deliver N+1 first, and
+// subscribers would then skip N as already sent
+func (broadcaster *PGBroadcaster) RecordAndPublish(ctx context.Context, msg Message) (int64, error) {
+	params, err := newRoomEventParams(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := broadcaster.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Ps: no-op once committed
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	msg.Seq, err = pgstore.New(tx).InsertRoomEvent(ctx, params)
+	if err != nil {
+		return 0, err
+	}
+	if err := notify(ctx, tx, msg); err != nil {
+		return 0, err
+	}
+
+	return msg.Seq, tx.Commit(ctx)
+}
+
+// Listen returns once LISTEN on the channel of roomID is active on the listener connection
+// Ps: while the connection is down, it waits for the reconnection
+func (broadcaster *PGBroadcaster) Listen(ctx context.Context, roomID string) error {
+	broadcaster.mu.Lock()
+	broadcaster.rooms[roomID]++
+	broadcaster.wakeUp()
+	broadcaster.mu.Unlock()
+
+	for {
+		broadcaster.mu.Lock()
+		_, listening := broadcaster.listening[roomID]
+		changed := broadcaster.listeningChanged
+		broadcaster.mu.Unlock()
+
+		if listening {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			broadcaster.Unlisten(roomID)
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (broadcaster *PGBroadcaster) Unlisten(roomID string) {
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+
+	if broadcaster.rooms[roomID]--; broadcaster.rooms[roomID] <= 0 {
+		delete(broadcaster.rooms, roomID)
+	}
+	broadcaster.wakeUp()
+}
+
+func (broadcaster *PGBroadcaster) SetReceiver(receive func(Message)) {
+	broadcaster.receive = receive
+}
+
+func (broadcaster *PGBroadcaster) SetGapHandler(handle func(roomID string)) {
+	broadcaster.gap = handle
+}
+
+// setListening publishes the rooms LISTEN is active for and wakes up the waiting Listen calls
+// Ps: returns the rooms that were active before
+func (broadcaster *PGBroadcaster) setListening(listening map[string]struct{}) map[string]struct{} {
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+
+	previous := broadcaster.listening
+	broadcaster.listening = make(map[string]struct{}, len(listening))
+	for roomID := range listening {
+		broadcaster.listening[roomID] = struct{}{}
+	}
+	close(broadcaster.listeningChanged)
+	broadcaster.listeningChanged = make(chan struct{})
+
+	return previous
+}
+
+// wakeUp interrupts the current wait (mu must be held)
+func (broadcaster *PGBroadcaster) wakeUp() {
+	if broadcaster.cancelWait != nil {
+		broadcaster.cancelWait()
+	}
+}
+
+// run keeps a listener connection alive until ctx is done
+func (broadcaster *PGBroadcaster) run(ctx context.Context) {
+	for {
+		err := broadcaster.listen(ctx)
+		// Ps: the notifications of these rooms are lost until the next connection LISTENs again
+		lost := broadcaster.setListening(nil)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error(LogFailedToListenRoomEvents, "error", err)
+		if broadcaster.gap != nil {
+			for roomID := range lost {
+				broadcaster.gap(roomID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgListenRetryDelay):
+		}
+	}
+}
+
+// listen acquires a dedicated connection and forwards notifications until it fails
+func (broadcaster *PGBroadcaster) listen(ctx context.Context) error {
+	pooledConn, err := broadcaster.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Ps: the connection holds LISTEN state, so it must never go back to the pool
+	conn := pooledConn.Hijack()
+	defer conn.Close(context.Background())
+
+	// channels LISTENed on this connection
+	listening := make(map[string]struct{})
+
+	for {
+		// (a) Sync LISTEN state with the rooms wanted by the subscribers
+		broadcaster.mu.Lock()
+		wanted := make(map[string]struct{}, len(broadcaster.rooms))
+		for roomID := range broadcaster.rooms {
+			wanted[roomID] = struct{}{}
+		}
+		broadcaster.mu.Unlock()
+
+		if err := syncListening(ctx, conn, listening, wanted); err != nil {
+			return err
+		}
+		broadcaster.setListening(listening)
+
+		// (b) Wait for a notification or for a change on rooms
+		broadcaster.mu.Lock()
+		if !sameRooms(listening, broadcaster.rooms) {
+			// rooms changed while LISTEN/UNLISTEN was running
+			broadcaster.mu.Unlock()
+			continue
+		}
+		waitCtx, cancel := context.WithCancel(ctx)
+		broadcaster.cancelWait = cancel
+		broadcaster.mu.Unlock()
+
+		notification, err := conn.WaitForNotification(waitCtx)
+
+		broadcaster.mu.Lock()
+		broadcaster.cancelWait = nil
+		broadcaster.mu.Unlock()
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if waitCtx.Err() != nil {
+				// interrupted by Listen/Unlisten (the connection is still usable)
+				continue
+			}
+			return err
+		}
+
+		// (c) Forward to local subscribers
+		broadcaster.deliver(notification)
+	}
+}
+
+// deliver decodes a notification and hands it to the receiver
+func (broadcaster *PGBroadcaster) deliver(notification *pgconn.Notification) {
+	roomID, ok := strings.CutPrefix(notification.Channel, pgChannelPrefix)
+	if !ok || broadcaster.receive == nil {
+		return
+	}
+
+	var payload pgNotification
+	if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+		slog.Error(LogInvalidRoomEvent, "error", err, "channel", notification.Channel)
+		return
+	}
+
+	carrier := propagation.MapCarrier{"traceparent": payload.Traceparent}
+	spanContext := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+
+	broadcaster.receive(Message{Kind: payload.Kind, Value: payload.Value, Seq: payload.Seq, RoomID: roomID, spanContext: spanContext})
+}
+
+// notify sends msg on the channel of its room (delivered when db commits)
+func notify(ctx context.Context, db pgstore.DBTX, msg Message) error {
+	value, err := json.Marshal(msg.Value)
+	if err != nil {
+		return err
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(ctx, msg.spanContext), carrier)
+
+	payload, err := json.Marshal(pgNotification{Kind: msg.Kind, Value: value, Seq: msg.Seq, Traceparent: carrier.Get("traceparent")})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "SELECT pg_notify($1, $2)", pgChannelPrefix+msg.RoomID, string(payload))
+	return err
+}
+
+// syncListening issues LISTEN/UNLISTEN so that listening matches wanted
+func syncListening(ctx context.Context, conn *pgx.Conn, listening, wanted map[string]struct{}) error {
+	for roomID := range wanted {
+		if _, ok := listening[roomID]; ok {
+			continue
+		}
+		channel := pgx.Identifier{pgChannelPrefix + roomID}.Sanitize()
+		if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+			return err
+		}
+		listening[roomID] = struct{}{}
+	}
+
+	for roomID := range listening {
+		if _, ok := wanted[roomID]; ok {
+			continue
+		}
+		channel := pgx.Identifier{pgChannelPrefix + roomID}.Sanitize()
+		if _, err := conn.Exec(ctx, "UNLISTEN "+channel); err != nil {
+			return err
+		}
+		delete(listening, roomID)
+	}
+
+	return nil
+}
+
+// sameRooms reports whether both sets hold the same rooms
+func sameRooms(a map[string]struct{}, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for roomID := range a {
+		if _, ok := b[roomID]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RATE LIMITING
+// One token bucket per route class and client IP (see resolveClientIP), plus one per
+// participant when the request carries a token: a request takes a token from both
+// Ps1: REST routes and websocket commands of the same class share the buckets
+// Ps2: participant tokens are free, so POST /api/participants is limited by IP only, and a
+// fresh token never escapes the bucket of its IP
+// Ps3: classes without a limit are not limited
+
+// Route classes
+const (
+	RateClassParticipants = "participants"
+	RateClassRooms        = "rooms"
+	RateClassMessages     = "messages"
+	RateClassReactions    = "reactions"
+)
+
+// RateLimit: Burst requests at once, refilled at Rate per second
+type RateLimit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// NewRateLimit: bursts of count requests, refilled at count per period
+func NewRateLimit(count int, period time.Duration) RateLimit {
+	return RateLimit{Rate: rate.Limit(float64(count) / period.Seconds()), Burst: count}
+}
+
+// WithRateLimits sets the limit of each route class
+func WithRateLimits(limits map[string]RateLimit) Option {
+	return func(apiHandler *apiHandler) {
+		for class, limit := range limits {
+			apiHandler.rateLimiter.limits[class] = limit
+		}
+	}
+}
+
+// rateLimiter keeps the buckets of every class and client
+type rateLimiter struct {
+	limits map[string]RateLimit
+	mu     *sync.Mutex
+	// buckets by class + client
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateSweepInterval: how often idle buckets are dropped
+const rateSweepInterval = time.Minute
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limits:  make(map[string]RateLimit),
+		mu:      &sync.Mutex{},
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// (a) ALLOW
+// Take a token from the bucket of every client on class (all or none); when one is empty,
+// report how long to wait
+func (limiter *rateLimiter) allow(class string, clients ...string) (bool, time.Duration) {
+	limit, ok := limiter.limits[class]
+	if !ok {
+		return true, 0
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+	limiter.sweep(now)
+
+	reservations := make([]*rate.Reservation, 0, len(clients))
+	var wait time.Duration
+	for _, client := range clients {
+		key := class + "|" + client
+		bucket, ok := limiter.buckets[key]
+		if !ok {
+			bucket = &rateBucket{limiter: rate.NewLimiter(limit.Rate, limit.Burst)}
+			limiter.buckets[key] = bucket
+		}
+		bucket.lastSeen = now
+
+		reservation := bucket.limiter.ReserveN(now, 1)
+		reservations = append(reservations, reservation)
+		wait = max(wait, reservation.DelayFrom(now))
+	}
+
+	if wait > 0 {
+		// Ps: a refused request does not consume any token
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+		return false, wait
+	}
+
+	return true, 0
+}
+
+// sweep drops the buckets that had time to refill completely (same as a new one)
+// Ps: mu must be held
+func (limiter *rateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < rateSweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for key, bucket := range limiter.buckets {
+		bucketLimiter := bucket.limiter
+		refill := time.Duration(float64(bucketLimiter.Burst()) / float64(bucketLimiter.Limit()) * float64(time.Second))
+		if now.Sub(bucket.lastSeen) > refill {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// (b) RATE LIMITED ERROR
+// ErrRateLimited + how long the client should wait
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (err *rateLimitedError) Error() string { return ErrRateLimited.Message }
+func (err *rateLimitedError) Unwrap() error { return ErrRateLimited }
+
+// retryAfterSeconds rounds up, so retrying right after never hits an empty bucket
+func (err *rateLimitedError) retryAfterSeconds() int {
+	return int(math.Ceil(err.retryAfter.Seconds()))
+}
+
+// (c) CHECK COMMAND RATE LIMIT
+// Websocket commands take their token from the bucket of the matching REST routes
+func (apiHandler apiHandler) checkCommandRateLimit(sub *subscriber, kind string) error {
+	var class string
+	switch kind {
+	case CommandKindCreateMessage:
+		class = RateClassMessages
+	case CommandKindReact, CommandKindUnreact:
+		class = RateClassReactions
+	default:
+		return nil
+	}
+
+	if ok, retryAfter := apiHandler.rateLimiter.allow(class, sub.rateLimitClients...); !ok {
+		return &rateLimitedError{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// rateLimitClients: the client IP, plus the participant when known
+// Ps: participant tokens are free, so the IP is always charged too (a new token is not a new bucket)
+func rateLimitClients(req *http.Request) []string {
+	clients := []string{"ip:" + clientIPFromContext(req.Context())}
+	if participantID, ok := participantFromContext(req.Context()); ok {
+		clients = append(clients, "participant:"+participantID.String())
+	}
+	return clients
+}
+
+// (d) RATE LIMIT (middleware)
+// 429 + Retry-After (seconds) when the bucket of the caller on class is empty
+func (apiHandler apiHandler) rateLimit(class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+			clients := rateLimitClients(req)
+			// Ps: participant tokens are free, they cannot identify who asks for them
+			if class == RateClassParticipants {
+				clients = clients[:1]
+			}
+
+			if ok, retryAfter := apiHandler.rateLimiter.allow(class, clients...); !ok {
+				limited := &rateLimitedError{retryAfter: retryAfter}
+				respWriter.Header().Set("Retry-After", strconv.Itoa(limited.retryAfterSeconds()))
+				sendError(respWriter, req, limited)
+				return
+			}
+
+			next.ServeHTTP(respWriter, req)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+func withRateLimit(class string, count int, period time.Duration) api.Option {
+	return api.WithRateLimits(map[string]api.RateLimit{class: api.NewRateLimit(count, period)})
+}
+
+// An empty bucket answers 429 with Retry-After in whole seconds, rounded up
+func TestRateLimitRetryAfter(t *testing.T) {
+	server := newTestServer(t, withRateLimit(api.RateClassMessages, 1, 1500*time.Millisecond))
+	roomID, _ := createRoom(t, server)
+	createMessage(t, server, roomID, "first")
+
+	resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/"+roomID+"/messages/", `{"message":"second"}`, nil)
+	expectProblem(t, resp, data, http.StatusTooManyRequests, api.ErrRateLimited.Code)
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "2" {
+		t.Fatalf("Retry-After = %q, want 2", retryAfter)
+	}
+}
+
+// Refused requests do not take tokens: the bucket refills as if they never happened
+func TestRateLimitRefusedRequestsAreFree(t *testing.T) {
+	server := newTestServer(t, withRateLimit(api.RateClassMessages, 1, 300*time.Millisecond))
+	roomID, _ := createRoom(t, server)
+	createMessage(t, server, roomID, "first")
+
+	for i := 0; i < 5; i++ {
+		resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/"+roomID+"/messages/", `{"message":"refused"}`, nil)
+		expectProblem(t, resp, data, http.StatusTooManyRequests, api.ErrRateLimited.Code)
+	}
+
+	time.Sleep(350 * time.Millisecond)
+	createMessage(t, server, roomID, "after refill")
+}
+
+// Websocket commands take their token from the bucket of the REST route
+func TestRateLimitSharedWithCommands(t *testing.T) {
+	server := newTestServer(t, withRateLimit(api.RateClassMessages, 1, time.Minute))
+	roomID, _ := createRoom(t, server)
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+	createMessage(t, server, roomID, "rest")
+
+	sendCommand(t, conn, "1", api.CommandKindCreateMessage, api.CommandCreateMessage{Message: "command"})
+	event := readEventOf(t, conn, api.MessageKindCommandError)
+	result := decode[api.MessageCommandError](t, event.Value)
+	if result.RequestID != "1" || result.Code != api.ErrRateLimited.Code || result.RetryAfter < 1 {
+		t.Fatalf("command error = %+v", result)
+	}
+}
+
+// A fresh participant token does not get a fresh bucket: the client IP is charged too
+func TestRateLimitNewTokenSameIP(t *testing.T) {
+	server := newTestServer(t, withRateLimit(api.RateClassReactions, 1, time.Minute))
+	roomID, _ := createRoom(t, server)
+	path := "/api/rooms/" + roomID + "/messages/" + createMessage(t, server, roomID, "question") + "/react"
+
+	resp, data := doRequest(t, server, http.MethodPatch, path, "", participantHeader(createParticipant(t, server)))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first reaction: %d %s", resp.StatusCode, data)
+	}
+
+	resp, data = doRequest(t, server, http.MethodPatch, path, "", participantHeader(createParticipant(t, server)))
+	expectProblem(t, resp, data, http.StatusTooManyRequests, api.ErrRateLimited.Code)
+}
@@ -0,0 +1,71 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+func createParticipant(t *testing.T, server *httptest.Server) (token string) {
+	t.Helper()
+
+	resp, data := doRequest(t, server, http.MethodPost, "/api/participants", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create participant: %d %s", resp.StatusCode, data)
+	}
+
+	participant := decode[struct {
+		Token string `json:"token"`
+	}](t, data)
+
+	return participant.Token
+}
+
+func participantHeader(token string) http.Header {
+	return http.Header{"X-Participant-Token": {token}}
+}
+
+// Repeated react / unreact calls return the current count without broadcasting anything
+func TestReactionsAreIdempotent(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	messageID := createMessage(t, server, roomID, "question")
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+
+	participant := participantHeader(createParticipant(t, server))
+	path := "/api/rooms/" + roomID + "/messages/" + messageID + "/react"
+
+	steps := []struct {
+		method string
+		count  int64
+	}{
+		{http.MethodPatch, 1},
+		{http.MethodPatch, 1},
+		{http.MethodDelete, 0},
+		{http.MethodDelete, 0},
+	}
+	for i, step := range steps {
+		resp, data := doRequest(t, server, step.method, path, "", participant)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("step %d: %d %s", i, resp.StatusCode, data)
+		}
+		if count := decode[struct{ Count int64 }](t, data).Count; count != step.count {
+			t.Fatalf("step %d: count = %d, want %d", i, count, step.count)
+		}
+	}
+
+	// Ps: one event per change, the repeated calls in between have no sequence number
+	for _, want := range []testEvent{
+		{Kind: api.MessageKindMessageReactionIncreased, Seq: 2},
+		{Kind: api.MessageKindMessageReactionDecreased, Seq: 3},
+	} {
+		if event := readEvent(t, conn); event.Kind != want.Kind || event.Seq != want.Seq {
+			t.Fatalf("event = %+v, want %s seq %d", event, want.Kind, want.Seq)
+		}
+	}
+	expectNoEvent(t, conn, 50*time.Millisecond)
+}
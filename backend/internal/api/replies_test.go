@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+)
+
+type testReply struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	Reply     string `json:"reply"`
+}
+
+// Replies are listed oldest first, counted on their message and broadcast with the new count
+func TestReplies(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	messageID := createMessage(t, server, roomID, "question")
+	path := "/api/rooms/" + roomID + "/messages/" + messageID
+	conn := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, conn)
+
+	var created []string
+	for i, text := range []string{"+1", "  also on Windows  "} {
+		resp, data := doRequest(t, server, http.MethodPost, path+"/replies/", `{"reply":"`+text+`"}`, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("create reply: %d %s", resp.StatusCode, data)
+		}
+		reply := decode[testReply](t, data)
+		if reply.MessageID != messageID || reply.Reply != strings.TrimSpace(text) {
+			t.Fatalf("reply = %+v", reply)
+		}
+		created = append(created, reply.ID)
+
+		event := readEvent(t, conn)
+		value := decode[struct {
+			testReply
+			ReplyCount int64 `json:"reply_count"`
+		}](t, event.Value)
+		if event.Kind != api.MessageKindMessageReplyCreated || value.ID != reply.ID || value.ReplyCount != int64(i+1) {
+			t.Fatalf("event = %s %s", event.Kind, event.Value)
+		}
+	}
+
+	resp, data := doRequest(t, server, http.MethodGet, path+"/replies/", "", nil)
+	replies := decode[[]testReply](t, data)
+	if resp.StatusCode != http.StatusOK || len(replies) != 2 || replies[0].ID != created[0] || replies[1].ID != created[1] {
+		t.Fatalf("get replies: %d %s", resp.StatusCode, data)
+	}
+
+	resp, data = doRequest(t, server, http.MethodGet, path, "", nil)
+	if count := decode[struct {
+		ReplyCount int64 `json:"reply_count"`
+	}](t, data).ReplyCount; resp.StatusCode != http.StatusOK || count != 2 {
+		t.Fatalf("get message: %d %s", resp.StatusCode, data)
+	}
+}
+
+// Replies are limited like questions (255 characters) and must not be blank
+func TestReplyLengthLimit(t *testing.T) {
+	server := newTestServer(t)
+	roomID, _ := createRoom(t, server)
+	path := "/api/rooms/" + roomID + "/messages/" + createMessage(t, server, roomID, "question") + "/replies/"
+
+	resp, data := doRequest(t, server, http.MethodPost, path, `{"reply":"`+strings.Repeat("é", 256)+`"}`, nil)
+	expectProblem(t, resp, data, http.StatusUnprocessableEntity, api.ErrMessageRejected.Code)
+
+	for _, body := range []string{`{"reply":""}`, `{"reply":"   "}`, `{}`} {
+		resp, data = doRequest(t, server, http.MethodPost, path, body, nil)
+		expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidReply.Code)
+	}
+
+	resp, data = doRequest(t, server, http.MethodPost, path, `{"reply":"`+strings.Repeat("é", 255)+`"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create reply: %d %s", resp.StatusCode, data)
+	}
+}
+
+// Replies need an approved message of the same room
+func TestReplyToMissingMessage(t *testing.T) {
+	server := newTestServer(t)
+	roomID, hostSecret := createRoom(t, server)
+	otherRoomID, _ := createRoom(t, server)
+	approved := createMessage(t, server, roomID, "approved")
+	deleted := createMessage(t, server, roomID, "deleted")
+	resp, _ := doRequest(t, server, http.MethodDelete, "/api/rooms/"+roomID+"/messages/"+deleted, "", hostHeader(hostSecret))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete message: %d", resp.StatusCode)
+	}
+	resp, _ = doRequest(t, server, http.MethodPatch, "/api/rooms/"+roomID+"/moderation", `{"moderated":true}`, hostHeader(hostSecret))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("set moderation: %d", resp.StatusCode)
+	}
+	pending := createMessage(t, server, roomID, "pending")
+
+	tests := []struct {
+		name, roomID, messageID string
+	}{
+		{"unknown", roomID, "00000000-0000-0000-0000-000000000000"},
+		{"deleted", roomID, deleted},
+		{"pending", roomID, pending},
+		{"other room", otherRoomID, approved},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/api/rooms/" + test.roomID + "/messages/" + test.messageID + "/replies/"
+
+			resp, data := doRequest(t, server, http.MethodPost, path, `{"reply":"+1"}`, nil)
+			expectProblem(t, resp, data, http.StatusNotFound, api.ErrMessageNotFound.Code)
+			resp, data = doRequest(t, server, http.MethodGet, path, "", nil)
+			expectProblem(t, resp, data, http.StatusNotFound, api.ErrMessageNotFound.Code)
+		})
+	}
+
+	resp, data := doRequest(t, server, http.MethodPost, "/api/rooms/"+roomID+"/messages/not-a-uuid/replies/", `{"reply":"+1"}`, nil)
+	expectProblem(t, resp, data, http.StatusBadRequest, api.ErrInvalidMessageID.Code)
+}
@@ -0,0 +1,45 @@
+package api
+
+import "sync"
+
+// ROOM LOCKS
+// One mutex per room, created on demand and dropped once nobody holds or waits for it
+// Ps: the events of different rooms never wait for each other
+type roomLocks struct {
+	mu    *sync.Mutex
+	rooms map[string]*roomLock
+}
+
+type roomLock struct {
+	mu sync.Mutex
+	// refs: holders + waiters
+	refs int
+}
+
+func newRoomLocks() *roomLocks {
+	return &roomLocks{mu: &sync.Mutex{}, rooms: make(map[string]*roomLock)}
+}
+
+// lock locks roomID and returns its unlock
+func (locks *roomLocks) lock(roomID string) func() {
+	locks.mu.Lock()
+	lock, ok := locks.rooms[roomID]
+	if !ok {
+		lock = &roomLock{}
+		locks.rooms[roomID] = lock
+	}
+	lock.refs++
+	locks.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(locks.rooms, roomID)
+		}
+	}
+}
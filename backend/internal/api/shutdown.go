@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// SHUTDOWN
+// http.Server.Shutdown does not wait for websocket connections (they are hijacked), so
+// the handler closes them itself: every subscriber gets its queued events and then a
+// going away close frame (1001) telling it to reconnect
+// Ps: while draining, new subscriptions are refused with 503
+
+// Handler is the http.Handler returned by NewHandler plus its shutdown hook
+type Handler interface {
+	http.Handler
+	// Shutdown closes every subscriber with 1001 and waits for them to be gone
+	// Ps: when ctx is done first, the remaining connections are dropped and ctx.Err() is returned
+	Shutdown(ctx context.Context) error
+}
+
+func (apiHandler apiHandler) Shutdown(ctx context.Context) error {
+	// Ps: draining is set under mu, so no subscription is registered after the Wait below starts
+	apiHandler.mu.Lock()
+	apiHandler.draining.Store(true)
+	for _, subscribers := range apiHandler.subscribers {
+		for _, sub := range subscribers {
+			sub.goAway(websocket.CloseGoingAway, "Server shutting down")
+		}
+	}
+	apiHandler.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		apiHandler.connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		apiHandler.mu.Lock()
+		for _, subscribers := range apiHandler.subscribers {
+			for _, sub := range subscribers {
+				sub.cancel()
+			}
+		}
+		apiHandler.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// isDraining reports whether Shutdown has been called
+func (apiHandler apiHandler) isDraining() bool {
+	return apiHandler.draining.Load()
+}
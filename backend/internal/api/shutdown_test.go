@@ -0,0 +1,153 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/gorilla/websocket"
+)
+
+// replayStore: memstore, with each replay held until release is closed (or the connection ends)
+// Ps: the events are read before waiting, so the live events of the meantime stay queued
+type replayStore struct {
+	store.Store
+	replaying chan struct{}
+	release   chan struct{}
+}
+
+func newReplayStore() *replayStore {
+	return &replayStore{Store: memstore.New(), replaying: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (replayStore *replayStore) GetRoomEventsSince(ctx context.Context, arg pgstore.GetRoomEventsSinceParams) ([]pgstore.RoomEvent, error) {
+	events, err := replayStore.Store.GetRoomEventsSince(ctx, arg)
+	replayStore.replaying <- struct{}{}
+
+	select {
+	case <-replayStore.release:
+		return events, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// subscribeReplaying subscribes with ?since=0 and returns once the replay is held by query
+func subscribeReplaying(t *testing.T, server *httptest.Server, query *replayStore, roomID string) *websocket.Conn {
+	t.Helper()
+
+	conn := subscribe(t, server, "/subscribe/"+roomID+"?since=0")
+	select {
+	case <-query.replaying:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replay not started")
+	}
+
+	return conn
+}
+
+// Queued events reach the client before the going away close (1001), with the ?since to resume from
+func TestShutdownFlushesSubscribers(t *testing.T) {
+	query := newReplayStore()
+	handler := api.NewHandler(query)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	roomID, _ := createRoom(t, server)
+	conn := subscribeReplaying(t, server, query, roomID)
+	for i := 0; i < 3; i++ {
+		createMessage(t, server, roomID, fmt.Sprintf("question %d", i))
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- handler.Shutdown(ctx)
+	}()
+
+	// i. Readiness fails as soon as draining starts
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, data := doRequest(t, server, http.MethodGet, "/readyz", "", nil)
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			expectProblem(t, resp, data, http.StatusServiceUnavailable, api.ErrNotReady.Code)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still ready while shutting down: %d %s", resp.StatusCode, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(query.release)
+
+	// ii. Every queued event, then the close frame
+	for seq := int64(1); seq <= 3; seq++ {
+		if event := readEvent(t, conn); event.Kind != api.MessageKindMessageCreated || event.Seq != seq {
+			t.Fatalf("event = %s %d, want %s %d", event.Kind, event.Seq, api.MessageKindMessageCreated, seq)
+		}
+	}
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || !strings.HasSuffix(closeErr.Text, "?since=3") {
+		t.Fatalf("read after the events: %v, want close 1001 with ?since=3", err)
+	}
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+
+	// iii. Still not ready, and new subscriptions are refused
+	resp, data := doRequest(t, server, http.MethodGet, "/readyz", "", nil)
+	expectProblem(t, resp, data, http.StatusServiceUnavailable, api.ErrNotReady.Code)
+	resp, data = doRequest(t, server, http.MethodGet, "/subscribe/"+roomID, "", http.Header{
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+	})
+	expectProblem(t, resp, data, http.StatusServiceUnavailable, api.ErrShuttingDown.Code)
+}
+
+// A subscriber that cannot be flushed is dropped once ctx is done
+func TestShutdownContextExpires(t *testing.T) {
+	query := newReplayStore()
+	handler := api.NewHandler(query)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	roomID, _ := createRoom(t, server)
+	conn := subscribeReplaying(t, server, query, roomID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := handler.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Ps: the connection is closed right away, not left to time out
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("read after Shutdown: %v, want the connection closed", err)
+	}
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OverflowPolicy decides what happens when a subscriber send queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room for the new one
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDisconnect closes the connection of the slow subscriber
+	OverflowDisconnect
+)
+
+// websocketConfig holds the settings applied to every subscriber
+type websocketConfig struct {
+	// sendQueueSize: messages buffered per subscriber before overflowPolicy applies
+	sendQueueSize  int
+	overflowPolicy OverflowPolicy
+	// writeTimeout: maximum time to write a message to the client
+	writeTimeout time.Duration
+	// pingInterval: how often the server pings the client
+	pingInterval time.Duration
+	// pongTimeout: maximum time without hearing from the client before dropping it
+	// Ps: must be greater than pingInterval
+	pongTimeout time.Duration
+	// maxMessageSize: largest message accepted from the client (bytes)
+	maxMessageSize int64
+}
+
+// defaultWebsocketConfig is used when no option overrides it
+var defaultWebsocketConfig = websocketConfig{
+	sendQueueSize:  64,
+	overflowPolicy: OverflowDropOldest,
+	writeTimeout:   10 * time.Second,
+	pingInterval:   50 * time.Second,
+	pongTimeout:    60 * time.Second,
+	maxMessageSize: 4096,
+}
+
+// WithSendQueue sets the size of each subscriber send queue and what to do when it is full
+func WithSendQueue(size int, policy OverflowPolicy) Option {
+	return func(apiHandler *apiHandler) {
+		if size > 0 {
+			apiHandler.websocket.sendQueueSize = size
+		}
+		apiHandler.websocket.overflowPolicy = policy
+	}
+}
+
+// WithWriteTimeout sets the deadline for writing a message to a subscriber
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(apiHandler *apiHandler) {
+		if timeout > 0 {
+			apiHandler.websocket.writeTimeout = timeout
+		}
+	}
+}
+
+// WithKeepalive sets how often subscribers are pinged and how long to wait for their pong
+// Ps: pongTimeout shorter than pingInterval is raised so healthy clients are not dropped
+func WithKeepalive(pingInterval, pongTimeout time.Duration) Option {
+	return func(apiHandler *apiHandler) {
+		if pingInterval > 0 {
+			apiHandler.websocket.pingInterval = pingInterval
+		}
+		if pongTimeout > 0 {
+			apiHandler.websocket.pongTimeout = pongTimeout
+		}
+		if apiHandler.websocket.pongTimeout <= apiHandler.websocket.pingInterval {
+			apiHandler.websocket.pongTimeout = apiHandler.websocket.pingInterval + apiHandler.websocket.pingInterval/5
+		}
+	}
+}
+
+// subscriber is a websocket client connected to a room
+// Ps1: only the writer (writePump, or replay before it starts) touches the connection and lastSeq
+// Ps2: replaying, pending and disconnected are protected by apiHandler.mu
+type subscriber struct {
+	connection *websocket.Conn
+	config     websocketConfig
+	// cancel ends handleSubscribe (and so the connection)
+	cancel context.CancelFunc
+	// queue: outbound messages waiting for the writer
+	queue chan Message
+	// replaying: live events are held on pending until the missed ones have been sent
+	replaying bool
+	pending   []Message
+	// disconnected: dropped by OverflowDisconnect, later messages are ignored
+	disconnected bool
+	// lastSeq: last event sequence sent, so events replayed and received live are not sent twice
+	lastSeq int64
+	// rateLimitClients: who commands are rate limited as (client IP and participant at handshake)
+	rateLimitClients []string
+	// goingAway: closed on server shutdown or lost events (see goAway)
+	goingAway     chan struct{}
+	goingAwayOnce *sync.Once
+	// closeCode + closeReason: close frame sent once goingAway is closed
+	closeCode   int
+	closeReason string
+	// metrics: write failures and dropped messages are counted here
+	metrics *metrics
+	// tracer: writes of traced events get a span
+	tracer trace.Tracer
+}
+
+func newSubscriber(connection *websocket.Conn, cancel context.CancelFunc, config websocketConfig, metrics *metrics, tracer trace.Tracer) *subscriber {
+	return &subscriber{
+		connection:    connection,
+		config:        config,
+		metrics:       metrics,
+		tracer:        tracer,
+		cancel:        cancel,
+		queue:         make(chan Message, config.sendQueueSize),
+		goingAway:     make(chan struct{}),
+		goingAwayOnce: &sync.Once{},
+	}
+}
+
+// goAway asks the writer to flush the queue and close the connection with code (the first call wins)
+func (sub *subscriber) goAway(code int, reason string) {
+	sub.goingAwayOnce.Do(func() {
+		sub.closeCode, sub.closeReason = code, reason
+		close(sub.goingAway)
+	})
+}
+
+// enqueue hands msg to the writer without blocking (apiHandler.mu must be held)
+func (sub *subscriber) enqueue(msg Message) {
+	if sub.disconnected {
+		return
+	}
+	if sub.replaying {
+		sub.pending = append(sub.pending, msg)
+		return
+	}
+
+	select {
+	case sub.queue <- msg:
+		return
+	default:
+	}
+
+	// Queue is full: the client is not keeping up
+	switch sub.config.overflowPolicy {
+	case OverflowDisconnect:
+		slog.Warn(LogSubscriberQueueFull, "policy", "disconnect")
+		sub.metrics.droppedMessages.WithLabelValues("disconnect").Inc()
+		sub.disconnected = true
+		sub.cancel()
+		// Ps: the writer is likely blocked on this client, closing the connection unblocks it
+		_ = sub.connection.Close()
+	default:
+		// drop the oldest message
+		sub.metrics.droppedMessages.WithLabelValues("drop_oldest").Inc()
+		// Ps: apiHandler.mu serializes producers, so there is room after receiving one
+		select {
+		case <-sub.queue:
+		default:
+		}
+		select {
+		case sub.queue <- msg:
+		default:
+		}
+	}
+}
+
+// readPump reads from the client until the connection fails or ctx is done
+// Ps1: gorilla only processes control frames (close, ping, pong) while reading
+// Ps2: every frame extends the read deadline, so a dead peer is detected after pongTimeout
+// Ps3: data messages are handed to onMessage, one at a time
+func (sub *subscriber) readPump(ctx context.Context, onMessage func([]byte)) {
+	// a failed read means the client is gone: end the subscription right away
+	defer sub.cancel()
+
+	sub.connection.SetReadLimit(sub.config.maxMessageSize)
+	extendDeadline := func() error {
+		return sub.connection.SetReadDeadline(time.Now().Add(sub.config.pongTimeout))
+	}
+	if err := extendDeadline(); err != nil {
+		return
+	}
+	sub.connection.SetPongHandler(func(string) error { return extendDeadline() })
+
+	for ctx.Err() == nil {
+		_, data, err := sub.connection.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				slog.Warn(LogSubscriberDisconnected, "error", err)
+			}
+			return
+		}
+		if err := extendDeadline(); err != nil {
+			return
+		}
+		onMessage(data)
+	}
+}
+
+// writePump writes queued messages and pings until ctx is done or a write fails
+func (sub *subscriber) writePump(ctx context.Context) {
+	ticker := time.NewTicker(sub.config.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(sub.config.writeTimeout)
+			if err := sub.connection.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				sub.metrics.writeFailures.Inc()
+				sub.cancel()
+				return
+			}
+		case msg := <-sub.queue:
+			if err := sub.write(msg); err != nil {
+				// keep the log
+				slog.Error(LogFailedToNotifyClient, "error", err)
+				sub.metrics.writeFailures.Inc()
+				// cancel the connection with client
+				sub.cancel()
+				return
+			}
+		case <-sub.goingAway:
+			sub.closeGoingAway()
+			return
+		}
+	}
+}
+
+// closeGoingAway sends the queued messages, then the close frame of goAway with a reconnect hint
+// Ps: clients resume with /subscribe/{room_id}?since=SEQ and miss nothing
+func (sub *subscriber) closeGoingAway() {
+	defer sub.cancel()
+
+	// Ps: the writer is the only consumer of the queue
+	for len(sub.queue) > 0 {
+		if err := sub.write(<-sub.queue); err != nil {
+			sub.metrics.writeFailures.Inc()
+			return
+		}
+	}
+
+	hint := sub.closeReason + ", reconnect"
+	if sub.lastSeq > 0 {
+		hint = fmt.Sprintf("%s, reconnect with ?since=%d", sub.closeReason, sub.lastSeq)
+	}
+	deadline := time.Now().Add(sub.config.writeTimeout)
+	_ = sub.connection.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(sub.closeCode, hint), deadline)
+}
+
+// write sends msg to the client, skipping events it already has
+func (sub *subscriber) write(msg Message) (err error) {
+	if msg.Seq != 0 {
+		if msg.Seq <= sub.lastSeq {
+			return nil
+		}
+		sub.lastSeq = msg.Seq
+	}
+
+	// Ps: only events carrying a trace get a span (not replays, acks nor command errors)
+	if msg.spanContext.IsValid() {
+		_, span := startEventSpan(sub.tracer, "websocket.write", msg)
+		defer func() { endSpan(span, err) }()
+	}
+
+	if err := sub.connection.SetWriteDeadline(time.Now().Add(sub.config.writeTimeout)); err != nil {
+		return err
+	}
+	return sub.connection.WriteJSON(msg)
+}
+
+// replay sends the events of roomID after since, then queues the live events received meanwhile
+// Ps: it runs before writePump starts, so it can write to the connection directly
+func (apiHandler apiHandler) replay(ctx context.Context, roomID uuid.UUID, sub *subscriber, since int64) {
+	events, err := apiHandler.query.GetRoomEventsSince(ctx, pgstore.GetRoomEventsSinceParams{RoomID: roomID, Seq: since})
+	if err != nil {
+		// the client would silently miss events: drop it so it reconnects
+		slog.Error(LogFailedToReplayRoomEvents, "error", err, "room_id", roomID)
+		sub.cancel()
+		return
+	}
+
+	sub.lastSeq = since
+	for _, event := range events {
+		err := sub.write(Message{
+			Kind:   event.Kind,
+			Value:  json.RawMessage(event.Payload),
+			Seq:    event.Seq,
+			RoomID: roomID.String(),
+		})
+		if err != nil {
+			slog.Error(LogFailedToNotifyClient, "error", err)
+			sub.cancel()
+			return
+		}
+	}
+
+	// Switch to live delivery
+	apiHandler.mu.Lock()
+	defer apiHandler.mu.Unlock()
+
+	sub.replaying = false
+	for _, msg := range sub.pending {
+		sub.enqueue(msg)
+	}
+	sub.pending = nil
+}
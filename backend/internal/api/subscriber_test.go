@@ -0,0 +1,247 @@
+package api_test
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+
+	"github.com/gorilla/websocket"
+)
+
+// SUBSCRIBER TESTS
+// Slow clients are simulated with tiny socket buffers, so a client that stops reading
+// blocks the server writes after a few messages
+
+// smallBuffers: socket buffer size on both ends (the kernel rounds it up to its minimum)
+const smallBuffers = 1024
+
+// smallBuffersListener shrinks the send buffer of every accepted connection
+type smallBuffersListener struct {
+	net.Listener
+}
+
+func (listener smallBuffersListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetWriteBuffer(smallBuffers)
+	}
+	return conn, err
+}
+
+func newSmallBuffersServer(t *testing.T, opts ...api.Option) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(api.NewHandler(memstore.New(), opts...))
+	server.Listener = smallBuffersListener{server.Listener}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// subscribeStalled subscribes with a tiny receive buffer; the caller decides when (if ever) to read
+func subscribeStalled(t *testing.T, server *httptest.Server, roomID string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{
+		Subprotocols: []string{"wsrs"},
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				_ = tcpConn.SetReadBuffer(smallBuffers)
+			}
+			return conn, err
+		},
+	}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/subscribe/"+roomID, nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v (%v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// flood creates count messages in roomID (long enough to fill the buffers quickly)
+func flood(t *testing.T, server *httptest.Server, roomID string, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		createMessage(t, server, roomID, strings.Repeat("a", 200))
+	}
+}
+
+// readSeqs reads events until until (or until the connection fails), returning their sequence numbers
+func readSeqs(conn *websocket.Conn, until int64) ([]int64, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	var seqs []int64
+	for {
+		var event testEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			return seqs, err
+		}
+		if event.Kind != api.MessageKindMessageCreated {
+			continue
+		}
+		seqs = append(seqs, event.Seq)
+		if event.Seq == until {
+			return seqs, nil
+		}
+	}
+}
+
+// expectAllSeqs reads conn in the background (while the test floods the room) and returns a
+// check that every event from 1 to count arrived
+func expectAllSeqs(t *testing.T, conn *websocket.Conn, count int64) (check func()) {
+	done := make(chan struct{})
+	var seqs []int64
+	var err error
+	go func() {
+		defer close(done)
+		seqs, err = readSeqs(conn, count)
+	}()
+
+	return func() {
+		t.Helper()
+
+		<-done
+		if err != nil || int64(len(seqs)) != count {
+			t.Fatalf("healthy subscriber got %d events of %d: %v", len(seqs), count, err)
+		}
+	}
+}
+
+// expectClosed fails unless the server closes conn (a read timeout means it did not)
+func expectClosed(t *testing.T, conn *websocket.Conn, count int64) {
+	t.Helper()
+
+	seqs, err := readSeqs(conn, count)
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("stalled subscriber still connected after %d events: %v", len(seqs), err)
+	}
+}
+
+// waitMetric polls /metrics until it has a line starting with prefix
+func waitMetric(t *testing.T, server *httptest.Server, prefix string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	body := getMetrics(t, server)
+	for !strings.Contains(body, "\n"+prefix) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		body = getMetrics(t, server)
+	}
+	expectMetrics(t, body, prefix)
+}
+
+// (a) SEND QUEUE
+// drop oldest: the stalled subscriber misses events in the middle but gets the latest one
+func TestStalledSubscriberDropsOldest(t *testing.T) {
+	const count = 200
+	server := newSmallBuffersServer(t, api.WithSendQueue(2, api.OverflowDropOldest))
+	roomID, _ := createRoom(t, server)
+	stalled := subscribeStalled(t, server, roomID)
+	waitSubscribed(t, stalled)
+	healthy := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, healthy)
+
+	checkHealthy := expectAllSeqs(t, healthy, count)
+	flood(t, server, roomID, count)
+	checkHealthy()
+
+	seqs, err := readSeqs(stalled, count)
+	if err != nil {
+		t.Fatalf("stalled subscriber disconnected after %d events: %v", len(seqs), err)
+	}
+	if len(seqs) == count {
+		t.Fatal("no event dropped: the subscriber did not stall")
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] <= seqs[i-1] {
+			t.Fatalf("events out of order: %v", seqs)
+		}
+	}
+	waitMetric(t, server, `wsrs_websocket_dropped_messages_total{policy="drop_oldest"} `)
+}
+
+// disconnect: the stalled subscriber is dropped, the others get every event
+func TestStalledSubscriberDisconnected(t *testing.T) {
+	const count = 200
+	server := newSmallBuffersServer(t, api.WithSendQueue(2, api.OverflowDisconnect))
+	roomID, _ := createRoom(t, server)
+	stalled := subscribeStalled(t, server, roomID)
+	waitSubscribed(t, stalled)
+	healthy := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, healthy)
+
+	checkHealthy := expectAllSeqs(t, healthy, count)
+	flood(t, server, roomID, count)
+	checkHealthy()
+	waitMetric(t, server, `wsrs_websocket_dropped_messages_total{policy="disconnect"} 1`)
+
+	expectClosed(t, stalled, count)
+	waitMetric(t, server, `wsrs_websocket_subscribers 1`)
+}
+
+// A write blocked longer than the write timeout drops the subscriber
+func TestWriteTimeout(t *testing.T) {
+	const count = 200
+	server := newSmallBuffersServer(t, api.WithSendQueue(count, api.OverflowDisconnect), api.WithWriteTimeout(100*time.Millisecond))
+	roomID, _ := createRoom(t, server)
+	stalled := subscribeStalled(t, server, roomID)
+	waitSubscribed(t, stalled)
+
+	flood(t, server, roomID, count)
+	waitMetric(t, server, `wsrs_websocket_write_failures_total 1`)
+	waitMetric(t, server, `wsrs_websocket_subscribers 0`)
+
+	// Ps: the queue was large enough, nothing was dropped
+	if body := getMetrics(t, server); strings.Contains(body, "\nwsrs_websocket_dropped_messages_total{") {
+		t.Fatalf("messages dropped:\n%s", body)
+	}
+	expectClosed(t, stalled, count)
+}
+
+// (b) KEEPALIVE
+// A client that never answers pings is dropped after the pong timeout; one that reads stays
+func TestKeepalive(t *testing.T) {
+	server := newTestServer(t, api.WithKeepalive(50*time.Millisecond, 150*time.Millisecond))
+	roomID, _ := createRoom(t, server)
+
+	// Ps: gorilla answers pings while reading, so this one keeps reading in the background
+	responsive := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, responsive)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := responsive.ReadMessage(); err != nil {
+				failed <- err
+				return
+			}
+		}
+	}()
+
+	silent := subscribe(t, server, "/subscribe/"+roomID)
+	waitSubscribed(t, silent)
+	waitMetric(t, server, `wsrs_websocket_subscribers 2`)
+
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case err := <-failed:
+		t.Fatalf("responsive subscriber dropped: %v", err)
+	default:
+	}
+	waitMetric(t, server, `wsrs_websocket_subscribers 1`)
+
+	expectClosed(t, silent, 1)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TRACING
+// Spans, from a question sent to it reaching the attendees:
+// (1) "POST /api/rooms/{room_id}/messages" or "websocket.command create_message"
+// (2) "pgstore.InsertMessage" and the other queries (pgstore.QueryTracer, on the pool)
+// (3) "broadcast message_created": record the event + publish it
+// (4) "notify_clients message_created": queue it for the local subscribers (on every instance)
+// (5) "websocket.write message_created": one per subscriber
+// Ps1: (4) and (5) follow the event through the broadcaster (traceparent on PostgreSQL notifications)
+// Ps2: websocket subscriptions are not spans themselves (they last for hours), their commands are
+// Ps3: without a tracer provider (see tracing.Setup) every span is a no-op
+// Ps4: (1) to (3) carry wsrs.room_id (queries through traceRoom or broadcast, see pgstore.WithRoomID)
+
+const tracerName = "github.com/alexandrecpedro/ama-room/backend/internal/api"
+
+// Span attributes
+const (
+	attrRoomID       = attribute.Key("wsrs.room_id")
+	attrRequestID    = attribute.Key("wsrs.request_id")
+	attrEventKind    = attribute.Key("wsrs.event.kind")
+	attrEventSeq     = attribute.Key("wsrs.event.seq")
+	attrCommandKind  = attribute.Key("wsrs.command.kind")
+	attrCommandError = attribute.Key("wsrs.command.error")
+	attrSubscribers  = attribute.Key("wsrs.subscribers")
+)
+
+// WithTracerProvider sets where the handler spans go (the global provider by default)
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(apiHandler *apiHandler) {
+		apiHandler.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// (a) TRACE REQUEST (middleware)
+// One server span per request, named after the chi route pattern
+func (apiHandler apiHandler) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		if websocket.IsWebSocketUpgrade(req) {
+			next.ServeHTTP(respWriter, req)
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := apiHandler.tracer.Start(ctx, req.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.URLPath(req.URL.Path),
+				attrRequestID.String(middleware.GetReqID(req.Context())),
+			),
+		)
+		defer span.End()
+
+		wrapped := middleware.NewWrapResponseWriter(respWriter, req.ProtoMajor)
+		next.ServeHTTP(wrapped, req.WithContext(ctx))
+
+		// Ps: the pattern and the params are only known once the router has matched the request
+		routeContext := chi.RouteContext(req.Context())
+		if route := routeContext.RoutePattern(); route != "" {
+			span.SetName(req.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		if roomID := routeContext.URLParam("room_id"); roomID != "" {
+			span.SetAttributes(attrRoomID.String(roomID))
+		}
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// (a.1) TRACE ROOM (middleware)
+// Tag the queries of the routes under /{room_id} with the room (see pgstore.WithRoomID)
+func traceRoom(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		ctx := pgstore.WithRoomID(req.Context(), chi.URLParam(req, "room_id"))
+		next.ServeHTTP(respWriter, req.WithContext(ctx))
+	})
+}
+
+// (b) EVENT SPAN
+// Span of a room event, child of the span msg was published from
+func startEventSpan(tracer trace.Tracer, name string, msg Message, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := trace.ContextWithSpanContext(context.Background(), msg.spanContext)
+
+	return tracer.Start(ctx, name+" "+msg.Kind, trace.WithAttributes(append(attrs,
+		attrRoomID.String(msg.RoomID),
+		attrEventKind.String(msg.Kind),
+		attrEventSeq.Int64(msg.Seq),
+	)...))
+}
+
+// endSpan records err (when set) and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/api"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// tracedStore: memstore, with InsertMessage traced by pgstore.QueryTracer as the pool would
+type tracedStore struct {
+	store.Store
+	tracer *pgstore.QueryTracer
+}
+
+func (tracedStore tracedStore) InsertMessage(ctx context.Context, arg pgstore.InsertMessageParams) (uuid.UUID, error) {
+	ctx = tracedStore.tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "-- name: InsertMessage :one\nINSERT INTO messages"})
+	id, err := tracedStore.Store.InsertMessage(ctx, arg)
+	tracedStore.tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: err})
+
+	return id, err
+}
+
+// Asking a question records the route, query and broadcast spans, all tagged with the room
+func TestCreateMessageSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	query := tracedStore{Store: memstore.New(), tracer: pgstore.NewQueryTracer(provider)}
+	server := httptest.NewServer(api.NewHandler(query, api.WithTracerProvider(provider)))
+	t.Cleanup(server.Close)
+
+	roomID, _ := createRoom(t, server)
+	exporter.Reset()
+	createMessage(t, server, roomID, "question")
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	route := http.MethodPost + " /api/rooms/{room_id}/messages"
+	for _, name := range []string{route, "pgstore.InsertMessage", "broadcast " + api.MessageKindMessageCreated} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("no %q span in %v", name, spanNames(spans))
+		}
+		if !hasAttribute(span, attribute.String("wsrs.room_id", roomID)) {
+			t.Fatalf("span %q has no wsrs.room_id=%s: %v", name, roomID, span.Attributes)
+		}
+		if name != route && span.Parent.SpanID() != spans[route].SpanContext.SpanID() {
+			t.Fatalf("span %q is not a child of the route span", name)
+		}
+	}
+}
+
+func spanNames(spans map[string]tracetest.SpanStub) []string {
+	var names []string
+	for name := range spans {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func hasAttribute(span tracetest.SpanStub, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == want {
+			return true
+		}
+	}
+
+	return false
+}
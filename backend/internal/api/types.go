@@ -1,5 +1,15 @@
 package api
 
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
 // TYPE STRUCTURES
 // (a) MessageMessageReactionIncreased
 type MessageMessageReactionIncreased struct {
@@ -24,10 +34,241 @@ type MessageMessageCreated struct {
 	Message string `json:"message"`
 }
 
+// (d.1) MessageMessageDeleted
+type MessageMessageDeleted struct {
+	ID string `json:"id"`
+}
+
+// (d.2) MessageRoomStatusChanged
+type MessageRoomStatusChanged struct {
+	Status string `json:"status"`
+}
+
+// (d.2.1) MessageRoomModerationChanged
+type MessageRoomModerationChanged struct {
+	Moderated bool `json:"moderated"`
+}
+
+// (d.3) MessageAnswerCreated
+type MessageAnswerCreated answerResponse
+
+// (d.4) MessageAnswerUpdated
+type MessageAnswerUpdated answerResponse
+
+// (d.5) MessageAnswerDeleted
+type MessageAnswerDeleted struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+}
+
+// (d.6) MessageMessageReplyCreated: the reply + the new reply count of its message
+type MessageMessageReplyCreated struct {
+	replyResponse
+	ReplyCount int64 `json:"reply_count"`
+}
+
 // (e) Message
 type Message struct {
 	Kind  string `json:"kind"`
 	Value any    `json:"value"`
+	// Seq: per room event sequence number (resume with /subscribe/{room_id}?since=SEQ)
+	Seq int64 `json:"seq,omitempty"`
 	// "-" => JSON package will not encode this value
 	RoomID string `json:"-"`
+	// spanContext: span the event was published from (unexported => not encoded either)
+	spanContext trace.SpanContext
+}
+
+// REST RESPONSES
+// Ps: the JSON contract is defined here, not by the pgstore models (sqlc regenerates them)
+// (e.0) roomResponse: a room without its host secret hash
+type roomResponse struct {
+	ID           string    `json:"id"`
+	Theme        string    `json:"theme"`
+	LastEventSeq int64     `json:"last_event_seq"`
+	Status       string    `json:"status"`
+	Moderated    bool      `json:"moderated"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newRoomResponse(room pgstore.Room) roomResponse {
+	return roomResponse{
+		ID:           room.ID.String(),
+		Theme:        room.Theme,
+		LastEventSeq: room.LastEventSeq,
+		Status:       room.Status,
+		Moderated:    room.Moderated,
+		CreatedAt:    room.CreatedAt,
+		UpdatedAt:    room.UpdatedAt,
+	}
+}
+
+// (e.1) messageResponse: a message as seen by the caller
+type messageResponse struct {
+	ID            string     `json:"id"`
+	RoomID        string     `json:"room_id"`
+	Message       string     `json:"message"`
+	Status        string     `json:"status"`
+	ReactionCount int64      `json:"reaction_count"`
+	ReplyCount    int64      `json:"reply_count"`
+	Answered      bool       `json:"answered"`
+	AnsweredAt    *time.Time `json:"answered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	// Reacted: the calling participant has already reacted to this message
+	Reacted bool `json:"reacted"`
+	// Answers written by the host, oldest first
+	Answers []answerResponse `json:"answers"`
+}
+
+func newMessageResponse(message pgstore.Message, reacted bool, answers []pgstore.Answer) messageResponse {
+	response := messageResponse{
+		ID:            message.ID.String(),
+		RoomID:        message.RoomID.String(),
+		Message:       message.Message,
+		Status:        message.Status,
+		ReactionCount: message.ReactionCount,
+		ReplyCount:    message.ReplyCount,
+		Answered:      message.Answered,
+		AnsweredAt:    message.AnsweredAt,
+		CreatedAt:     message.CreatedAt,
+		UpdatedAt:     message.UpdatedAt,
+		Reacted:       reacted,
+		Answers:       make([]answerResponse, 0, len(answers)),
+	}
+	for _, answer := range answers {
+		response.Answers = append(response.Answers, newAnswerResponse(answer))
+	}
+
+	return response
+}
+
+// (e.2) answerResponse: an answer written by the host
+type answerResponse struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"message_id"`
+	Answer    string    `json:"answer"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newAnswerResponse(answer pgstore.Answer) answerResponse {
+	return answerResponse{
+		ID:        answer.ID.String(),
+		MessageID: answer.MessageID.String(),
+		Answer:    answer.Answer,
+		CreatedAt: answer.CreatedAt,
+		UpdatedAt: answer.UpdatedAt,
+	}
+}
+
+// (e.2.1) replyResponse: a follow-up on a message
+type replyResponse struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"message_id"`
+	Reply     string    `json:"reply"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newReplyResponse(reply pgstore.Reply) replyResponse {
+	return replyResponse{
+		ID:        reply.ID.String(),
+		MessageID: reply.MessageID.String(),
+		Reply:     reply.Reply,
+		CreatedAt: reply.CreatedAt,
+	}
+}
+
+// (e.3) problem: RFC 7807 problem details + the catalog code and the request id
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// (e.3.1) readinessProblem: ErrNotReady + the detail of each readiness check (extension member)
+type readinessProblem struct {
+	problem
+	Checks []healthCheckResponse `json:"checks"`
+}
+
+// (e.4) healthResponse: /healthz and /readyz (Checks only on /readyz)
+type healthResponse struct {
+	Status string                `json:"status"`
+	Checks []healthCheckResponse `json:"checks,omitempty"`
+}
+
+// (e.4.1) healthCheckResponse: one readiness check (Error only when failing)
+type healthCheckResponse struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WEBSOCKET COMMANDS (client -> server)
+// (f) Command: same envelope as Message plus a request id echoed on the reply
+type Command struct {
+	RequestID string          `json:"request_id"`
+	Kind      string          `json:"kind"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// (g) CommandCreateMessage: value of create_message
+type CommandCreateMessage struct {
+	Message string `json:"message"`
+}
+
+// (g.1) CommandCreateMessageResult: result of create_message (and of POST .../messages)
+// Ps: status is pending on moderated rooms and when a filter flagged the message (Reason says why)
+type CommandCreateMessageResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// (h) CommandMessageID: value of react, unreact and mark_answered
+type CommandMessageID struct {
+	ID string `json:"id"`
+}
+
+// (h.1) CommandReactionResult: result of react and unreact
+type CommandReactionResult struct {
+	ID    string `json:"id"`
+	Count int64  `json:"count"`
+}
+
+// (i) MessageCommandAck: value of command_ack (Result depends on the command)
+type MessageCommandAck struct {
+	RequestID string `json:"request_id"`
+	Result    any    `json:"result,omitempty"`
+}
+
+// (j) MessageCommandError: value of command_error
+// Ps: RetryAfter (seconds) is only set on rate_limited
+type MessageCommandError struct {
+	RequestID  string `json:"request_id"`
+	Code       string `json:"code"`
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+func newMessageCommandError(requestID string, err error) MessageCommandError {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrSomethingWentWrong
+	}
+
+	commandErr := MessageCommandError{RequestID: requestID, Code: apiErr.Code, Error: apiErr.Message}
+	var limited *rateLimitedError
+	if errors.As(err, &limited) {
+		commandErr.RetryAfter = limited.retryAfterSeconds()
+	}
+
+	return commandErr
 }
@@ -1,16 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"time"
 
 	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SHARED FUNCTIONS
@@ -25,7 +31,7 @@ func (apiHandler apiHandler) readRoom(
 	// Verify if roomID is valid
 	roomID, err := uuid.Parse(rawRoomID)
 	if err != nil {
-		http.Error(respWriter, ErrInvalidRoomID, http.StatusBadRequest)
+		sendError(respWriter, req, ErrInvalidRoomID)
 		return pgstore.Room{}, "", uuid.UUID{}, false
 	}
 
@@ -33,38 +39,180 @@ func (apiHandler apiHandler) readRoom(
 	room, err = apiHandler.query.GetRoom(req.Context(), roomID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			http.Error(respWriter, ErrRoomNotFound, http.StatusNotFound)
+			sendError(respWriter, req, ErrRoomNotFound)
 			return pgstore.Room{}, "", uuid.UUID{}, false
 		}
 
-		slog.Error(ErrFailedToGetRoom, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
+		slog.Error(LogFailedToGetRoom, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
 		return pgstore.Room{}, "", uuid.UUID{}, false
 	}
 
 	return room, rawRoomID, roomID, true
 }
 
+// (a.1) READ MESSAGE ID
+func readMessageID(respWriter http.ResponseWriter, req *http.Request) (messageID uuid.UUID, ok bool) {
+	messageID, err := uuid.Parse(chi.URLParam(req, "message_id"))
+	if err != nil {
+		sendError(respWriter, req, ErrInvalidMessageID)
+		return uuid.UUID{}, false
+	}
+
+	return messageID, true
+}
+
+// (a.2) READ ANSWER ID
+func readAnswerID(respWriter http.ResponseWriter, req *http.Request) (answerID uuid.UUID, ok bool) {
+	answerID, err := uuid.Parse(chi.URLParam(req, "answer_id"))
+	if err != nil {
+		sendError(respWriter, req, ErrInvalidAnswerID)
+		return uuid.UUID{}, false
+	}
+
+	return answerID, true
+}
+
 // (b) SEND JSON
-func sendJSON(respWriter http.ResponseWriter, rawData any) {
+func sendJSON(respWriter http.ResponseWriter, req *http.Request, rawData any) {
 	// Encoding JSON from response
 	data, err := json.Marshal(rawData)
 	if err != nil {
-		http.Error(respWriter, ErrInvalidJSON, http.StatusBadRequest)
+		slog.Error(LogFailedToReturnResponse, "error", err)
+		sendError(respWriter, req, ErrSomethingWentWrong)
 		return
 	}
 
 	// Response return
+	// Ps: once the body is being written the status cannot change anymore, so only log
 	respWriter.Header().Set("Content-Type", "application/json")
-	_, err = respWriter.Write(data)
+	if _, err := respWriter.Write(data); err != nil {
+		slog.Error(LogFailedToReturnResponse, "error", err)
+	}
+}
+
+// (b.1) SEND ERROR
+// Write err as an RFC 7807 problem (application/problem+json)
+// Ps: errors outside the catalog are internal failures (already logged) => ErrSomethingWentWrong
+func sendError(respWriter http.ResponseWriter, req *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrSomethingWentWrong
+	}
+
+	sendProblem(respWriter, apiErr.Status, newProblem(req, apiErr))
+}
+
+// (b.2) NEW PROBLEM
+func newProblem(req *http.Request, apiErr *Error) problem {
+	return problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Message,
+		Instance:  req.URL.Path,
+		Code:      apiErr.Code,
+		RequestID: middleware.GetReqID(req.Context()),
+	}
+}
+
+// (b.3) SEND PROBLEM
+// Write body (a problem, possibly with extension members) as application/problem+json
+// Ps: the only place error statuses are written; every error path goes through it
+func sendProblem(respWriter http.ResponseWriter, status int, body any) {
+	data, _ := json.Marshal(body)
+
+	respWriter.Header().Set("Content-Type", "application/problem+json")
+	respWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	respWriter.WriteHeader(status)
+	if _, err := respWriter.Write(data); err != nil {
+		slog.Error(LogFailedToReturnResponse, "error", err)
+	}
+}
+
+// (c) BROADCAST
+// Record a room event (assigning its sequence number) and publish it to every instance
+// Ps1: each instance notifies its own clients
+// Ps2: actions call it before returning (see actions.go): ctx keeps its values (trace, participant)
+// but not its cancellation, so a client hanging up cannot lose an event of a change already made
+func (apiHandler apiHandler) broadcast(ctx context.Context, msg Message) {
+	ctx = pgstore.WithRoomID(context.WithoutCancel(ctx), msg.RoomID)
+	start := time.Now()
+
+	ctx, span := apiHandler.tracer.Start(ctx, "broadcast "+msg.Kind, trace.WithAttributes(
+		attrRoomID.String(msg.RoomID),
+		attrEventKind.String(msg.Kind),
+	))
+	defer span.End()
+
+	msg.spanContext = span.SpanContext()
+	if err := apiHandler.recordAndPublish(ctx, &msg); err != nil {
+		slog.Error(LogFailedToPublishMessage, "error", err, "room_id", msg.RoomID)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attrEventSeq.Int64(msg.Seq))
+
+	apiHandler.metrics.broadcastPublished.WithLabelValues(msg.Kind).Inc()
+	apiHandler.metrics.broadcastDuration.Observe(time.Since(start).Seconds())
+}
+
+// (c.1) RECORD AND PUBLISH
+// Record msg (setting msg.Seq), then publish it
+// Ps1: an EventRecorder broadcaster (PostgreSQL) does both in one transaction
+// Ps2: when recording fails, live clients still get the event (without sequence number)
+func (apiHandler apiHandler) recordAndPublish(ctx context.Context, msg *Message) error {
+	var seq int64
+	var err error
+	if recorder, ok := apiHandler.broadcaster.(EventRecorder); ok {
+		// Ps: no lock, InsertRoomEvent locks the room row until the notification is committed
+		if seq, err = recorder.RecordAndPublish(ctx, *msg); err == nil {
+			msg.Seq = seq
+			return nil
+		}
+	} else {
+		// Sequence numbers of a room must reach the broadcaster in order
+		unlock := apiHandler.eventLocks.lock(msg.RoomID)
+		defer unlock()
+		seq, err = apiHandler.recordEvent(ctx, *msg)
+	}
 	if err != nil {
-		slog.Error(ErrFailedToReturnRegisteredRoom, "error", err)
-		http.Error(respWriter, ErrSomethingWentWrong, http.StatusInternalServerError)
-		return
+		slog.Error(LogFailedToRecordRoomEvent, "error", err, "room_id", msg.RoomID)
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+
+	msg.Seq = seq
+	return apiHandler.broadcaster.Publish(ctx, *msg)
+}
+
+// (d) RECORD EVENT
+// Persist a room event so disconnected clients can replay it
+func (apiHandler apiHandler) recordEvent(ctx context.Context, msg Message) (int64, error) {
+	params, err := newRoomEventParams(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return apiHandler.query.InsertRoomEvent(ctx, params)
+}
+
+// (d.1) ROOM EVENT PARAMS
+func newRoomEventParams(msg Message) (pgstore.InsertRoomEventParams, error) {
+	roomID, err := uuid.Parse(msg.RoomID)
+	if err != nil {
+		return pgstore.InsertRoomEventParams{}, err
+	}
+
+	payload, err := json.Marshal(msg.Value)
+	if err != nil {
+		return pgstore.InsertRoomEventParams{}, err
 	}
+
+	return pgstore.InsertRoomEventParams{RoomID: roomID, Kind: msg.Kind, Payload: payload}, nil
 }
 
-// (c) NOTIFY CLIENTS
+// (e) NOTIFY CLIENTS
+// Hand a room event to the subscribers connected to this instance
 func (apiHandler apiHandler) notifyClients(msg Message) {
 	// Lock the map to iterate an get each client
 	apiHandler.mu.Lock()
@@ -76,14 +224,36 @@ func (apiHandler apiHandler) notifyClients(msg Message) {
 		return
 	}
 
-	// Notify each client
-	for connection, cancel := range subscribers {
-		if err := connection.WriteJSON(msg); err != nil {
-			// keep the log
-			slog.Error(ErrFailedToNotifyClient, "error", err)
-			// cancel the connection with client
-			// Ps: it is not necessary to remove from the map (the signal will be received and the client will be remove as done before)
-			cancel()
-		}
+	// Queue the message for each client
+	// Ps: enqueue never blocks, so a slow client cannot stall the room
+	start := time.Now()
+	_, span := startEventSpan(apiHandler.tracer, "notify_clients", msg, attrSubscribers.Int(len(subscribers)))
+	for _, sub := range subscribers {
+		sub.enqueue(msg)
 	}
+	span.End()
+	apiHandler.metrics.fanoutDuration.Observe(time.Since(start).Seconds())
+	apiHandler.metrics.fanoutSubscribers.Observe(float64(len(subscribers)))
+}
+
+// (f) RECOVERER (middleware)
+// Same as middleware.Recoverer, but the client gets a problem instead of an empty 500
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respWriter http.ResponseWriter, req *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// Ps: http.ErrAbortHandler is how handlers abort on purpose
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			slog.Error(LogPanicRecovered, "panic", rvr, "stack", string(debug.Stack()), "request_id", middleware.GetReqID(req.Context()))
+			sendError(respWriter, req, ErrSomethingWentWrong)
+		}()
+
+		next.ServeHTTP(respWriter, req)
+	})
 }
@@ -0,0 +1,518 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/tracing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+// CONFIGURATION
+// Every setting is read, by priority, from: (1) its command line flag, (2) its environment
+// variable, (3) the .env file (optional), (4) its default
+// Ps1: the flag of a variable is its name without WSRS_, in lower case with dashes
+// (WSRS_WS_SEND_QUEUE_SIZE => -ws-send-queue-size, DATABASE_URL => -database-url)
+// Ps2: Load checks every setting and reports all the invalid ones at once
+// Ps3: Print shows the effective values with secrets redacted
+
+// Config is the validated configuration of the server
+type Config struct {
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Websocket WebsocketConfig
+	Filters   FiltersConfig
+	// ParticipantSecret signs participant tokens (empty => random, tokens do not survive a restart)
+	ParticipantSecret string
+	// TrustedProxies may report the client IP (Forwarded / X-Forwarded-For / X-Real-IP)
+	TrustedProxies []netip.Prefix
+	// RateLimits by route class
+	RateLimits RateLimitsConfig
+	// TracingExporter: tracing.ExporterNone, ExporterStdout or ExporterOTLP
+	TracingExporter string
+
+	// resolved: every setting with its value and where it came from (see Print)
+	resolved []resolvedSetting
+}
+
+// ServerConfig: HTTP server
+type ServerConfig struct {
+	Port              int
+	CORSOrigins       []string
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	ShutdownDelay     time.Duration
+	// Broadcaster: "local" (single instance) or "postgres" (LISTEN/NOTIFY across replicas)
+	Broadcaster string
+}
+
+// DatabaseConfig: PostgreSQL connection and pool sizing
+// Ps: URL wins over the WSRS_DATABASE_HOST, PORT, NAME, USER and PASSWORD parts
+type DatabaseConfig struct {
+	URL      string
+	Host     string
+	Port     int
+	Name     string
+	User     string
+	Password string
+	// Pool sizing (0 keeps the pgx default)
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// WebsocketConfig: subscriber queues and keepalive
+type WebsocketConfig struct {
+	SendQueueSize int
+	// OverflowPolicy: "drop_oldest" or "disconnect" when a send queue is full
+	OverflowPolicy string
+	WriteTimeout   time.Duration
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+}
+
+// FiltersConfig: content filters of participant text
+type FiltersConfig struct {
+	MaxLength      int
+	BlockedWords   []string
+	FlaggedWords   []string
+	BlockedPattern *regexp.Regexp
+	FlaggedPattern *regexp.Regexp
+	// Links: "allow", "flag" or "reject"
+	Links string
+}
+
+// RateLimitsConfig: rate limit of each route class
+type RateLimitsConfig struct {
+	Participants RateLimit
+	Rooms        RateLimit
+	Messages     RateLimit
+	Reactions    RateLimit
+}
+
+// RateLimit: bursts of Count requests, refilled at Count per Period (zero => not limited)
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+}
+
+// minParticipantSecretLength: shorter secrets can be brute forced from a single token (HMAC-SHA256)
+const minParticipantSecretLength = 32
+
+// Part 1: Settings
+type setting struct {
+	env  string
+	def  string
+	help string
+	// redact: how Print shows the value (nil => as is)
+	redact func(string) string
+}
+
+var settings = []setting{
+	// (a) Server
+	{env: "SERVER_PORT", def: "8080", help: "HTTP port"},
+	{env: "WSRS_CORS_ORIGINS", def: "https://*,http://*", help: "comma separated origins allowed by CORS (* is a wildcard)"},
+	{env: "WSRS_HTTP_READ_HEADER_TIMEOUT", def: "10s", help: "time to read the request headers"},
+	{env: "WSRS_HTTP_IDLE_TIMEOUT", def: "2m", help: "time a keep-alive connection waits for the next request"},
+	{env: "WSRS_SHUTDOWN_TIMEOUT", def: "25s", help: "time to drain HTTP requests and close websockets on SIGINT/SIGTERM"},
+	{env: "WSRS_SHUTDOWN_DELAY", def: "0s", help: "time between /readyz failing and the HTTP server closing"},
+	{env: "WSRS_BROADCASTER", def: "local", help: `"local" (single instance) or "postgres" (LISTEN/NOTIFY across replicas)`},
+	// (b) Database
+	{env: "DATABASE_URL", help: "PostgreSQL connection string (overrides the WSRS_DATABASE_* parts)", redact: redactURL},
+	{env: "WSRS_DATABASE_HOST", help: "PostgreSQL host"},
+	{env: "WSRS_DATABASE_PORT", def: "5432", help: "PostgreSQL port"},
+	{env: "WSRS_DATABASE_NAME", help: "PostgreSQL database"},
+	{env: "WSRS_DATABASE_USER", help: "PostgreSQL user"},
+	{env: "WSRS_DATABASE_PASSWORD", help: "PostgreSQL password", redact: redactSecret},
+	{env: "WSRS_DATABASE_MAX_CONNS", def: "0", help: "largest pool size (0 = pgx default, max(4, CPUs))"},
+	{env: "WSRS_DATABASE_MIN_CONNS", def: "0", help: "connections kept open when idle"},
+	{env: "WSRS_DATABASE_MAX_CONN_LIFETIME", def: "1h", help: "connections are replaced after this time"},
+	{env: "WSRS_DATABASE_MAX_CONN_IDLE_TIME", def: "30m", help: "idle connections are closed after this time"},
+	// (c) Websocket
+	{env: "WSRS_WS_SEND_QUEUE_SIZE", def: "64", help: "messages buffered per subscriber"},
+	{env: "WSRS_WS_OVERFLOW_POLICY", def: "drop_oldest", help: `"drop_oldest" or "disconnect" when a send queue is full`},
+	{env: "WSRS_WS_WRITE_TIMEOUT", def: "10s", help: "time to write a message to a subscriber"},
+	{env: "WSRS_WS_PING_INTERVAL", def: "50s", help: "how often subscribers are pinged"},
+	{env: "WSRS_WS_PONG_TIMEOUT", def: "60s", help: "silent subscribers are dropped after this time"},
+	// (d) Participants
+	{env: "WSRS_PARTICIPANT_SECRET", help: "secret signing participant tokens, at least 32 bytes (empty = random on every start)", redact: redactSecret},
+	// (e) Content filters
+	{env: "WSRS_FILTER_MAX_LENGTH", def: "255", help: "longest question or reply, in characters (at most 255)"},
+	{env: "WSRS_FILTER_BLOCKED_WORDS", help: "comma separated words rejected"},
+	{env: "WSRS_FILTER_FLAGGED_WORDS", help: "comma separated words held for the host approval"},
+	{env: "WSRS_FILTER_BLOCKED_PATTERN", help: "regular expression rejected"},
+	{env: "WSRS_FILTER_FLAGGED_PATTERN", help: "regular expression held for the host approval"},
+	{env: "WSRS_FILTER_LINKS", def: "allow", help: `links: "allow", "flag" or "reject"`},
+	// (f) Client IP
+	{env: "WSRS_TRUSTED_PROXIES", help: "comma separated CIDR list of the proxies allowed to report the client IP"},
+	// (g) Rate limits ("N/PERIOD", empty = unlimited)
+	{env: "WSRS_RATE_LIMIT_PARTICIPANTS", help: "participant tokens per client IP"},
+	{env: "WSRS_RATE_LIMIT_ROOMS", help: "rooms created per client"},
+	{env: "WSRS_RATE_LIMIT_MESSAGES", help: "questions and replies per client"},
+	{env: "WSRS_RATE_LIMIT_REACTIONS", help: "reactions per client"},
+	// (h) Tracing
+	{env: "WSRS_TRACING_EXPORTER", def: tracing.ExporterNone, help: `"none", "stdout" or "otlp" (see OTEL_EXPORTER_OTLP_ENDPOINT)`},
+}
+
+// flagName: WSRS_WS_SEND_QUEUE_SIZE => ws-send-queue-size
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, "WSRS_")), "_", "-")
+}
+
+// Part 2: Load
+// Value sources
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceEnvFile = ".env"
+	sourceDefault = "default"
+)
+
+type resolvedSetting struct {
+	setting
+	value  string
+	source string
+}
+
+// Load reads the configuration from args (command line, without the program name), the
+// environment and the .env file
+// Ps1: the .env file also fills the process environment (OTEL_* variables are read from there)
+// Ps2: -h returns flag.ErrHelp after printing the usage
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("wsrs", flag.ContinueOnError)
+	envFile := flags.String("env-file", ".env", "file with environment variables (optional unless set)")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.env] = flags.String(flagName(s.env), "", fmt.Sprintf("%s (env %s, default %q)", s.help, s.env, s.def))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	// (a) Variables set before the .env file is loaded come from the environment
+	fromEnv := make(map[string]bool)
+	for _, s := range settings {
+		_, fromEnv[s.env] = os.LookupEnv(s.env)
+	}
+	if err := godotenv.Load(*envFile); err != nil {
+		// Ps: the default file is optional, an explicit one is not
+		if setFlags["env-file"] || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("env file %s: %w", *envFile, err)
+		}
+	}
+
+	// (b) Resolve every setting
+	config := &Config{}
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		resolved := resolvedSetting{setting: s, value: s.def, source: sourceDefault}
+		if setFlags[flagName(s.env)] {
+			resolved.value, resolved.source = *flagValues[s.env], sourceFlag
+		} else if value, ok := os.LookupEnv(s.env); ok {
+			resolved.value, resolved.source = value, sourceEnvFile
+			if fromEnv[s.env] {
+				resolved.source = sourceEnv
+			}
+		}
+		resolved.value = strings.TrimSpace(resolved.value)
+
+		values[s.env] = resolved.value
+		config.resolved = append(config.resolved, resolved)
+	}
+
+	// (c) Parse and validate
+	if err := config.parse(&parser{values: values}); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Part 3: Parse
+func (config *Config) parse(p *parser) error {
+	// (a) Server
+	config.Server = ServerConfig{
+		Port:              p.integer("SERVER_PORT", 1, 65535),
+		CORSOrigins:       p.list("WSRS_CORS_ORIGINS"),
+		ReadHeaderTimeout: p.duration("WSRS_HTTP_READ_HEADER_TIMEOUT", time.Millisecond),
+		IdleTimeout:       p.duration("WSRS_HTTP_IDLE_TIMEOUT", time.Millisecond),
+		ShutdownTimeout:   p.duration("WSRS_SHUTDOWN_TIMEOUT", time.Millisecond),
+		ShutdownDelay:     p.duration("WSRS_SHUTDOWN_DELAY", 0),
+		Broadcaster:       p.oneOf("WSRS_BROADCASTER", "local", "postgres"),
+	}
+	if len(config.Server.CORSOrigins) == 0 {
+		p.fail("WSRS_CORS_ORIGINS", "at least one origin is required")
+	}
+	if config.Server.ShutdownDelay >= config.Server.ShutdownTimeout && config.Server.ShutdownTimeout > 0 {
+		p.fail("WSRS_SHUTDOWN_DELAY", "must be shorter than WSRS_SHUTDOWN_TIMEOUT")
+	}
+
+	// (b) Database
+	config.Database = DatabaseConfig{
+		URL:             p.str("DATABASE_URL"),
+		Host:            p.str("WSRS_DATABASE_HOST"),
+		Port:            p.integer("WSRS_DATABASE_PORT", 1, 65535),
+		Name:            p.str("WSRS_DATABASE_NAME"),
+		User:            p.str("WSRS_DATABASE_USER"),
+		Password:        p.str("WSRS_DATABASE_PASSWORD"),
+		MaxConns:        int32(p.integer("WSRS_DATABASE_MAX_CONNS", 0, 10000)),
+		MinConns:        int32(p.integer("WSRS_DATABASE_MIN_CONNS", 0, 10000)),
+		MaxConnLifetime: p.duration("WSRS_DATABASE_MAX_CONN_LIFETIME", time.Second),
+		MaxConnIdleTime: p.duration("WSRS_DATABASE_MAX_CONN_IDLE_TIME", time.Second),
+	}
+	if config.Database.URL == "" {
+		for _, env := range []string{"WSRS_DATABASE_HOST", "WSRS_DATABASE_NAME", "WSRS_DATABASE_USER"} {
+			if p.str(env) == "" {
+				p.fail(env, "required (or set DATABASE_URL)")
+			}
+		}
+	}
+	if config.Database.MaxConns > 0 && config.Database.MinConns > config.Database.MaxConns {
+		p.fail("WSRS_DATABASE_MIN_CONNS", "must not exceed WSRS_DATABASE_MAX_CONNS")
+	}
+	if config.Database.URL != "" {
+		if _, err := pgxpool.ParseConfig(config.Database.URL); err != nil {
+			// Ps: the pgx message may quote the connection string (and its password), so it is not repeated
+			p.fail("DATABASE_URL", "invalid connection string")
+		}
+	}
+
+	// (c) Websocket
+	config.Websocket = WebsocketConfig{
+		SendQueueSize:  p.integer("WSRS_WS_SEND_QUEUE_SIZE", 1, 1<<16),
+		OverflowPolicy: p.oneOf("WSRS_WS_OVERFLOW_POLICY", "drop_oldest", "disconnect"),
+		WriteTimeout:   p.duration("WSRS_WS_WRITE_TIMEOUT", time.Millisecond),
+		PingInterval:   p.duration("WSRS_WS_PING_INTERVAL", time.Millisecond),
+		PongTimeout:    p.duration("WSRS_WS_PONG_TIMEOUT", time.Millisecond),
+	}
+	if config.Websocket.PongTimeout <= config.Websocket.PingInterval {
+		p.fail("WSRS_WS_PONG_TIMEOUT", "must be longer than WSRS_WS_PING_INTERVAL")
+	}
+
+	// (d) Participants
+	config.ParticipantSecret = p.str("WSRS_PARTICIPANT_SECRET")
+	if config.ParticipantSecret != "" && len(config.ParticipantSecret) < minParticipantSecretLength {
+		p.fail("WSRS_PARTICIPANT_SECRET", "must be at least %d bytes (e.g. openssl rand -base64 48)", minParticipantSecretLength)
+	}
+
+	// (e) Content filters
+	// Ps: messages.message and replies.reply are VARCHAR(255)
+	config.Filters = FiltersConfig{
+		MaxLength:      p.integer("WSRS_FILTER_MAX_LENGTH", 1, 255),
+		BlockedWords:   p.list("WSRS_FILTER_BLOCKED_WORDS"),
+		FlaggedWords:   p.list("WSRS_FILTER_FLAGGED_WORDS"),
+		BlockedPattern: p.pattern("WSRS_FILTER_BLOCKED_PATTERN"),
+		FlaggedPattern: p.pattern("WSRS_FILTER_FLAGGED_PATTERN"),
+		Links:          p.oneOf("WSRS_FILTER_LINKS", "allow", "flag", "reject"),
+	}
+
+	// (f) Client IP
+	config.TrustedProxies = p.prefixes("WSRS_TRUSTED_PROXIES")
+
+	// (g) Rate limits
+	config.RateLimits = RateLimitsConfig{
+		Participants: p.rateLimit("WSRS_RATE_LIMIT_PARTICIPANTS"),
+		Rooms:        p.rateLimit("WSRS_RATE_LIMIT_ROOMS"),
+		Messages:     p.rateLimit("WSRS_RATE_LIMIT_MESSAGES"),
+		Reactions:    p.rateLimit("WSRS_RATE_LIMIT_REACTIONS"),
+	}
+
+	// (h) Tracing
+	config.TracingExporter = p.oneOf("WSRS_TRACING_EXPORTER", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP)
+
+	return p.err()
+}
+
+// ConnString: URL, or a keyword/value connection string of the parts
+// Ps: it holds the password, never log it
+func (database DatabaseConfig) ConnString() string {
+	if database.URL != "" {
+		return database.URL
+	}
+
+	// Ps: quoted, so values with spaces or quotes survive
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	return fmt.Sprintf("user='%s' password='%s' host='%s' port=%d dbname='%s'",
+		quote(database.User), quote(database.Password), quote(database.Host), database.Port, quote(database.Name))
+}
+
+// PoolConfig: pgxpool configuration of the connection string + pool sizing
+func (database DatabaseConfig) PoolConfig() (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(database.ConnString())
+	if err != nil {
+		return nil, err
+	}
+
+	if database.MaxConns > 0 {
+		poolConfig.MaxConns = database.MaxConns
+	}
+	if database.MinConns > 0 {
+		poolConfig.MinConns = database.MinConns
+	}
+	if database.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = database.MaxConnLifetime
+	}
+	if database.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = database.MaxConnIdleTime
+	}
+
+	return poolConfig, nil
+}
+
+// parser reads typed values and collects every error
+type parser struct {
+	values map[string]string
+	errs   []error
+}
+
+func (p *parser) fail(env, format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf("%s: %s", env, fmt.Sprintf(format, args...)))
+}
+
+func (p *parser) err() error {
+	return errors.Join(p.errs...)
+}
+
+func (p *parser) str(env string) string {
+	return p.values[env]
+}
+
+func (p *parser) integer(env string, min, max int) int {
+	value, err := strconv.Atoi(p.values[env])
+	if err != nil || value < min || value > max {
+		p.fail(env, "expected an integer between %d and %d, got %q", min, max, p.values[env])
+		return 0
+	}
+	return value
+}
+
+func (p *parser) duration(env string, min time.Duration) time.Duration {
+	value, err := time.ParseDuration(p.values[env])
+	if err != nil || value < min {
+		p.fail(env, "expected a duration of at least %s (e.g. 30s, 5m), got %q", min, p.values[env])
+		return 0
+	}
+	return value
+}
+
+func (p *parser) oneOf(env string, allowed ...string) string {
+	value := p.values[env]
+	for _, candidate := range allowed {
+		if value == candidate {
+			return value
+		}
+	}
+	p.fail(env, "expected one of %s, got %q", strings.Join(allowed, ", "), value)
+	return ""
+}
+
+// list: comma separated values (blanks dropped)
+func (p *parser) list(env string) []string {
+	var values []string
+	for _, value := range strings.Split(p.values[env], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (p *parser) pattern(env string) *regexp.Regexp {
+	if p.values[env] == "" {
+		return nil
+	}
+	compiled, err := regexp.Compile(p.values[env])
+	if err != nil {
+		p.fail(env, "%v", err)
+		return nil
+	}
+	return compiled
+}
+
+// prefixes: comma separated CIDR prefixes (a bare IP is a /32 or /128)
+func (p *parser) prefixes(env string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range p.list(env) {
+		if !strings.Contains(entry, "/") {
+			ip, err := netip.ParseAddr(entry)
+			if err != nil {
+				p.fail(env, "%v", err)
+				return nil
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			p.fail(env, "%v", err)
+			return nil
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// rateLimit: "N/PERIOD" (e.g. "10/1m": bursts of 10, refilled at 10 per minute), empty => not limited
+func (p *parser) rateLimit(env string) RateLimit {
+	raw := p.values[env]
+	if raw == "" {
+		return RateLimit{}
+	}
+
+	rawCount, rawPeriod, _ := strings.Cut(raw, "/")
+	count, countErr := strconv.Atoi(strings.TrimSpace(rawCount))
+	period, periodErr := time.ParseDuration(strings.TrimSpace(rawPeriod))
+	if countErr != nil || count < 1 || periodErr != nil || period <= 0 {
+		p.fail(env, "expected N/PERIOD with N >= 1 (e.g. 10/1m), got %q", raw)
+		return RateLimit{}
+	}
+	return RateLimit{Count: count, Period: period}
+}
+
+// Part 4: Print
+// Print writes every setting with its effective value and source, secrets redacted
+func (config *Config) Print(w io.Writer) {
+	fmt.Fprintln(w, "Configuration:")
+	for _, resolved := range config.resolved {
+		value := resolved.value
+		if resolved.redact != nil && value != "" {
+			value = resolved.redact(value)
+		}
+		fmt.Fprintf(w, "  %-34s %-24q (%s)\n", resolved.env, value, resolved.source)
+	}
+}
+
+func redactSecret(string) string {
+	return "[redacted]"
+}
+
+// redactURL keeps everything but the password (keyword/value strings are hidden entirely)
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" {
+		return "[redacted]"
+	}
+	query := parsed.Query()
+	if query.Has("password") {
+		query.Set("password", "xxxxx")
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,91 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/config"
+)
+
+// load runs Load with a database (always required) and args
+func load(args ...string) (*config.Config, error) {
+	return config.Load(append([]string{"-database-url", "postgres://localhost:5432/wsrs"}, args...))
+}
+
+func TestParticipantSecretLength(t *testing.T) {
+	if _, err := load("-participant-secret", "change-me"); err == nil || !strings.Contains(err.Error(), "WSRS_PARTICIPANT_SECRET") {
+		t.Fatalf("short secret: err = %v", err)
+	}
+
+	secret := strings.Repeat("s", 32)
+	cfg, err := load("-participant-secret", secret)
+	if err != nil || cfg.ParticipantSecret != secret {
+		t.Fatalf("32 bytes secret: %v", err)
+	}
+
+	// Ps: empty => random on every start
+	if _, err := load("-participant-secret", ""); err != nil {
+		t.Fatalf("empty secret: %v", err)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	cfg, err := load("-rate-limit-messages", "10/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimits.Messages != (config.RateLimit{Count: 10, Period: time.Minute}) || cfg.RateLimits.Rooms != (config.RateLimit{}) {
+		t.Fatalf("rate limits = %+v", cfg.RateLimits)
+	}
+
+	for _, raw := range []string{"10", "0/1m", "10/0s", "ten/1m"} {
+		if _, err := load("-rate-limit-rooms", raw); err == nil || !strings.Contains(err.Error(), "WSRS_RATE_LIMIT_ROOMS") {
+			t.Fatalf("%q: err = %v", raw, err)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	cfg, err := load("-trusted-proxies", "10.0.0.1, 192.168.1.7/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[0].String() != "10.0.0.1/32" || cfg.TrustedProxies[1].String() != "192.168.1.0/24" {
+		t.Fatalf("trusted proxies = %v", cfg.TrustedProxies)
+	}
+
+	if _, err := load("-trusted-proxies", "not-an-ip"); err == nil {
+		t.Fatal("invalid proxy accepted")
+	}
+}
+
+// The connection string (used by the pool and by terndotenv) comes from DATABASE_URL or the parts
+func TestDatabaseConnString(t *testing.T) {
+	cfg, err := load("-database-host", "db.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connString := cfg.Database.ConnString(); connString != "postgres://localhost:5432/wsrs" {
+		t.Fatalf("URL: conn string = %q", connString)
+	}
+
+	cfg, err = config.Load([]string{
+		"-database-host", "db.internal",
+		"-database-port", "6432",
+		"-database-name", "wsrs",
+		"-database-user", "app",
+		"-database-password", `it's a \ pass`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig, err := cfg.Database.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := poolConfig.ConnConfig
+	if conn.Host != "db.internal" || conn.Port != 6432 || conn.Database != "wsrs" || conn.User != "app" || conn.Password != `it's a \ pass` {
+		t.Fatalf("parts: conn config = %s:%d/%s %s %q", conn.Host, conn.Port, conn.Database, conn.User, conn.Password)
+	}
+}
@@ -0,0 +1,608 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRoomDoesNotExist mirrors the foreign key violation PostgreSQL returns
+// when a message references an unknown room
+var ErrRoomDoesNotExist = errors.New("memstore: room does not exist")
+
+// ErrMessageDoesNotExist mirrors the foreign key violation PostgreSQL returns
+// when an answer references an unknown message
+var ErrMessageDoesNotExist = errors.New("memstore: message does not exist")
+
+// Store is an in-memory implementation of the queries generated by sqlc
+// Ps1: it is safe for concurrent use and keeps insertion order, like a table without ORDER BY in practice
+// Ps2: lookups that find nothing return pgx.ErrNoRows, so handlers behave exactly as with PostgreSQL
+type Store struct {
+	mu *sync.RWMutex
+	// (a) rooms indexed by id + insertion order
+	rooms   map[uuid.UUID]pgstore.Room
+	roomIDs []uuid.UUID
+	// (b) messages indexed by id + insertion order
+	messages   map[uuid.UUID]pgstore.Message
+	messageIDs []uuid.UUID
+	// (b.1) participants who reacted, by message
+	reactions map[uuid.UUID]map[uuid.UUID]struct{}
+	// (b.2) answers indexed by id + insertion order
+	answers   map[uuid.UUID]pgstore.Answer
+	answerIDs []uuid.UUID
+	// (b.3) replies by message, oldest first
+	replies map[uuid.UUID][]pgstore.Reply
+	// (c) room events by room, ordered by seq
+	events map[uuid.UUID][]pgstore.RoomEvent
+}
+
+// Compile-time check: Store must satisfy store.Store
+var _ store.Store = (*Store)(nil)
+
+// New creates an empty in-memory store
+func New() *Store {
+	return &Store{
+		mu:        &sync.RWMutex{},
+		rooms:     make(map[uuid.UUID]pgstore.Room),
+		messages:  make(map[uuid.UUID]pgstore.Message),
+		events:    make(map[uuid.UUID][]pgstore.RoomEvent),
+		reactions: make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		answers:   make(map[uuid.UUID]pgstore.Answer),
+		replies:   make(map[uuid.UUID][]pgstore.Reply),
+	}
+}
+
+// (a) ROOMS
+func (s *Store) GetRoom(_ context.Context, id uuid.UUID) (pgstore.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return pgstore.Room{}, pgx.ErrNoRows
+	}
+
+	return room, nil
+}
+
+func (s *Store) GetRoomsPage(_ context.Context, arg pgstore.GetRoomsPageParams) ([]pgstore.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rooms []pgstore.Room
+	for _, id := range s.roomIDs {
+		room := s.rooms[id]
+		// Ps: archived rooms are not listed
+		if room.Status == "archived" {
+			continue
+		}
+		if !arg.HasCursor || before(room.CreatedAt, room.ID, arg.CursorCreatedAt, arg.CursorID) {
+			rooms = append(rooms, room)
+		}
+	}
+
+	// ORDER BY created_at DESC, id DESC LIMIT page_limit
+	sort.Slice(rooms, func(i, j int) bool {
+		return before(rooms[j].CreatedAt, rooms[j].ID, rooms[i].CreatedAt, rooms[i].ID)
+	})
+	if len(rooms) > int(arg.PageLimit) {
+		rooms = rooms[:arg.PageLimit]
+	}
+
+	return rooms, nil
+}
+
+func (s *Store) InsertRoom(_ context.Context, arg pgstore.InsertRoomParams) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, createdAt := uuid.New(), now()
+	s.rooms[id] = pgstore.Room{
+		ID:             id,
+		Theme:          arg.Theme,
+		HostSecretHash: append([]byte{}, arg.HostSecretHash...),
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		// DEFAULT 'open'
+		Status:    "open",
+		Moderated: arg.Moderated,
+	}
+	s.roomIDs = append(s.roomIDs, id)
+
+	return id, nil
+}
+
+func (s *Store) UpdateRoomStatus(_ context.Context, arg pgstore.UpdateRoomStatusParams) (pgstore.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[arg.ID]
+	if !ok {
+		return pgstore.Room{}, pgx.ErrNoRows
+	}
+
+	room.Status = arg.Status
+	room.UpdatedAt = now()
+	s.rooms[arg.ID] = room
+
+	return room, nil
+}
+
+func (s *Store) UpdateRoomModeration(_ context.Context, arg pgstore.UpdateRoomModerationParams) (pgstore.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[arg.ID]
+	if !ok {
+		return pgstore.Room{}, pgx.ErrNoRows
+	}
+
+	room.Moderated = arg.Moderated
+	room.UpdatedAt = now()
+	s.rooms[arg.ID] = room
+
+	return room, nil
+}
+
+// (b) MESSAGES
+func (s *Store) GetMessage(_ context.Context, id uuid.UUID) (pgstore.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.messages[id]
+	if !ok {
+		return pgstore.Message{}, pgx.ErrNoRows
+	}
+
+	return message, nil
+}
+
+// (b.0) MESSAGES PAGES
+func (s *Store) GetRoomMessagesNewest(_ context.Context, arg pgstore.GetRoomMessagesNewestParams) ([]pgstore.Message, error) {
+	return s.roomMessagesPage(arg.RoomID, arg.PageLimit,
+		func(a, b pgstore.Message) bool {
+			return before(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+		},
+		func(message pgstore.Message) bool {
+			return !arg.HasCursor || before(message.CreatedAt, message.ID, arg.CursorCreatedAt, arg.CursorID)
+		},
+	), nil
+}
+
+func (s *Store) GetRoomMessagesMostReacted(_ context.Context, arg pgstore.GetRoomMessagesMostReactedParams) ([]pgstore.Message, error) {
+	return s.roomMessagesPage(arg.RoomID, arg.PageLimit,
+		func(a, b pgstore.Message) bool {
+			if a.ReactionCount != b.ReactionCount {
+				return a.ReactionCount > b.ReactionCount
+			}
+			return before(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+		},
+		func(message pgstore.Message) bool {
+			if !arg.HasCursor || message.ReactionCount < arg.CursorReactionCount {
+				return true
+			}
+			return message.ReactionCount == arg.CursorReactionCount &&
+				before(message.CreatedAt, message.ID, arg.CursorCreatedAt, arg.CursorID)
+		},
+	), nil
+}
+
+func (s *Store) GetRoomMessagesUnansweredFirst(_ context.Context, arg pgstore.GetRoomMessagesUnansweredFirstParams) ([]pgstore.Message, error) {
+	return s.roomMessagesPage(arg.RoomID, arg.PageLimit,
+		func(a, b pgstore.Message) bool {
+			if a.Answered != b.Answered {
+				return !a.Answered
+			}
+			return before(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+		},
+		func(message pgstore.Message) bool {
+			if !arg.HasCursor || (message.Answered && !arg.CursorAnswered) {
+				return true
+			}
+			return message.Answered == arg.CursorAnswered &&
+				before(message.CreatedAt, message.ID, arg.CursorCreatedAt, arg.CursorID)
+		},
+	), nil
+}
+
+// roomMessagesPage returns the first limit messages of roomID kept by after, in the order given by less
+func (s *Store) roomMessagesPage(
+	roomID uuid.UUID,
+	limit int32,
+	less func(a, b pgstore.Message) bool,
+	after func(pgstore.Message) bool,
+) []pgstore.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Ps: pages only list approved messages
+	var messages []pgstore.Message
+	for _, id := range s.messageIDs {
+		if message := s.messages[id]; message.RoomID == roomID && message.Status == "approved" && after(message) {
+			messages = append(messages, message)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return less(messages[i], messages[j]) })
+	if len(messages) > int(limit) {
+		messages = messages[:limit]
+	}
+
+	return messages
+}
+
+func (s *Store) InsertMessage(_ context.Context, arg pgstore.InsertMessageParams) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// FOREIGN KEY (room_id) REFERENCES rooms(id)
+	if _, ok := s.rooms[arg.RoomID]; !ok {
+		return uuid.UUID{}, ErrRoomDoesNotExist
+	}
+
+	id, createdAt := uuid.New(), now()
+	s.messages[id] = pgstore.Message{
+		ID:        id,
+		RoomID:    arg.RoomID,
+		Message:   arg.Message,
+		Status:    arg.Status,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	s.messageIDs = append(s.messageIDs, id)
+
+	return id, nil
+}
+
+// (b.0.1) MODERATION QUEUE
+func (s *Store) GetRoomPendingMessages(_ context.Context, roomID uuid.UUID) ([]pgstore.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Ps: insertion order is ORDER BY created_at, id
+	var messages []pgstore.Message
+	for _, id := range s.messageIDs {
+		if message := s.messages[id]; message.RoomID == roomID && message.Status == "pending" {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (s *Store) ModerateMessage(_ context.Context, arg pgstore.ModerateMessageParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ps: only pending messages are updated (rows affected tells the caller)
+	message, ok := s.messages[arg.ID]
+	if !ok || message.Status != "pending" {
+		return 0, nil
+	}
+
+	message.Status = arg.Status
+	message.UpdatedAt = now()
+	s.messages[arg.ID] = message
+
+	return 1, nil
+}
+
+func (s *Store) MarkMessageAsAnswered(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ps: an UPDATE matching no rows is not an error for :exec queries
+	if message, ok := s.messages[id]; ok {
+		message.Answered = true
+		message.UpdatedAt = now()
+		// Ps: answering again keeps the first answered_at
+		if message.AnsweredAt == nil {
+			answeredAt := message.UpdatedAt
+			message.AnsweredAt = &answeredAt
+		}
+		s.messages[id] = message
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteMessage(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[id]; !ok {
+		return nil
+	}
+
+	delete(s.messages, id)
+	// ON DELETE CASCADE
+	delete(s.reactions, id)
+	delete(s.replies, id)
+	answerIDs := s.answerIDs[:0]
+	for _, answerID := range s.answerIDs {
+		if s.answers[answerID].MessageID == id {
+			delete(s.answers, answerID)
+			continue
+		}
+		answerIDs = append(answerIDs, answerID)
+	}
+	s.answerIDs = answerIDs
+	for i, messageID := range s.messageIDs {
+		if messageID == id {
+			s.messageIDs = append(s.messageIDs[:i], s.messageIDs[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// (b.1) REACTIONS
+func (s *Store) ReactToMessage(_ context.Context, arg pgstore.ReactToMessageParams) (pgstore.ReactToMessageRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, ok := s.messages[arg.MessageID]
+	if !ok {
+		return pgstore.ReactToMessageRow{}, pgx.ErrNoRows
+	}
+
+	// Ps: reacting twice is a no-op (ON CONFLICT DO NOTHING)
+	participants, ok := s.reactions[arg.MessageID]
+	if !ok {
+		participants = make(map[uuid.UUID]struct{})
+		s.reactions[arg.MessageID] = participants
+	}
+	if _, ok := participants[arg.ParticipantID]; ok {
+		return pgstore.ReactToMessageRow{ReactionCount: message.ReactionCount}, nil
+	}
+
+	participants[arg.ParticipantID] = struct{}{}
+	message.ReactionCount++
+	message.UpdatedAt = now()
+	s.messages[arg.MessageID] = message
+
+	return pgstore.ReactToMessageRow{ReactionCount: message.ReactionCount, Changed: true}, nil
+}
+
+func (s *Store) RemoveReactionFromMessage(_ context.Context, arg pgstore.RemoveReactionFromMessageParams) (pgstore.RemoveReactionFromMessageRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, ok := s.messages[arg.MessageID]
+	if !ok {
+		return pgstore.RemoveReactionFromMessageRow{}, pgx.ErrNoRows
+	}
+
+	// Ps: removing a reaction that does not exist is a no-op
+	if _, ok := s.reactions[arg.MessageID][arg.ParticipantID]; !ok {
+		return pgstore.RemoveReactionFromMessageRow{ReactionCount: message.ReactionCount}, nil
+	}
+
+	delete(s.reactions[arg.MessageID], arg.ParticipantID)
+	message.ReactionCount--
+	message.UpdatedAt = now()
+	s.messages[arg.MessageID] = message
+
+	return pgstore.RemoveReactionFromMessageRow{ReactionCount: message.ReactionCount, Changed: true}, nil
+}
+
+func (s *Store) HasParticipantReacted(_ context.Context, arg pgstore.HasParticipantReactedParams) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.reactions[arg.MessageID][arg.ParticipantID]
+	return ok, nil
+}
+
+func (s *Store) GetParticipantRoomReactions(_ context.Context, arg pgstore.GetParticipantRoomReactionsParams) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messageIDs []uuid.UUID
+	for _, id := range s.messageIDs {
+		if s.messages[id].RoomID != arg.RoomID {
+			continue
+		}
+		if _, ok := s.reactions[id][arg.ParticipantID]; ok {
+			messageIDs = append(messageIDs, id)
+		}
+	}
+
+	return messageIDs, nil
+}
+
+// (b.2) ANSWERS
+func (s *Store) GetAnswer(_ context.Context, id uuid.UUID) (pgstore.Answer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	answer, ok := s.answers[id]
+	if !ok {
+		return pgstore.Answer{}, pgx.ErrNoRows
+	}
+
+	return answer, nil
+}
+
+func (s *Store) GetMessageAnswers(ctx context.Context, messageID uuid.UUID) ([]pgstore.Answer, error) {
+	return s.GetAnswersByMessageIDs(ctx, []uuid.UUID{messageID})
+}
+
+func (s *Store) GetAnswersByMessageIDs(_ context.Context, messageIds []uuid.UUID) ([]pgstore.Answer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[uuid.UUID]struct{}, len(messageIds))
+	for _, id := range messageIds {
+		wanted[id] = struct{}{}
+	}
+
+	// Ps: insertion order is ORDER BY created_at, id
+	var answers []pgstore.Answer
+	for _, id := range s.answerIDs {
+		if _, ok := wanted[s.answers[id].MessageID]; ok {
+			answers = append(answers, s.answers[id])
+		}
+	}
+
+	return answers, nil
+}
+
+func (s *Store) InsertAnswer(_ context.Context, arg pgstore.InsertAnswerParams) (pgstore.Answer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// FOREIGN KEY (message_id) REFERENCES messages(id)
+	if _, ok := s.messages[arg.MessageID]; !ok {
+		return pgstore.Answer{}, ErrMessageDoesNotExist
+	}
+
+	createdAt := now()
+	answer := pgstore.Answer{
+		ID:        uuid.New(),
+		MessageID: arg.MessageID,
+		Answer:    arg.Answer,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	s.answers[answer.ID] = answer
+	s.answerIDs = append(s.answerIDs, answer.ID)
+
+	return answer, nil
+}
+
+func (s *Store) UpdateAnswer(_ context.Context, arg pgstore.UpdateAnswerParams) (pgstore.Answer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	answer, ok := s.answers[arg.ID]
+	if !ok {
+		return pgstore.Answer{}, pgx.ErrNoRows
+	}
+
+	answer.Answer = arg.Answer
+	answer.UpdatedAt = now()
+	s.answers[arg.ID] = answer
+
+	return answer, nil
+}
+
+func (s *Store) DeleteAnswer(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteAnswer(id)
+	return nil
+}
+
+// deleteAnswer removes an answer (mu must be held)
+func (s *Store) deleteAnswer(id uuid.UUID) {
+	if _, ok := s.answers[id]; !ok {
+		return
+	}
+
+	delete(s.answers, id)
+	for i, answerID := range s.answerIDs {
+		if answerID == id {
+			s.answerIDs = append(s.answerIDs[:i], s.answerIDs[i+1:]...)
+			break
+		}
+	}
+}
+
+// (b.3) REPLIES
+func (s *Store) GetMessageReplies(_ context.Context, messageID uuid.UUID) ([]pgstore.Reply, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var replies []pgstore.Reply
+	return append(replies, s.replies[messageID]...), nil
+}
+
+func (s *Store) InsertReply(_ context.Context, arg pgstore.InsertReplyParams) (pgstore.InsertReplyRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ps: the UPDATE of the parent matches no row => no reply, no row returned
+	message, ok := s.messages[arg.MessageID]
+	if !ok {
+		return pgstore.InsertReplyRow{}, pgx.ErrNoRows
+	}
+
+	reply := pgstore.Reply{ID: uuid.New(), MessageID: arg.MessageID, Reply: arg.Reply, CreatedAt: now()}
+	s.replies[arg.MessageID] = append(s.replies[arg.MessageID], reply)
+
+	message.ReplyCount++
+	message.UpdatedAt = reply.CreatedAt
+	s.messages[arg.MessageID] = message
+
+	return pgstore.InsertReplyRow{
+		ID:         reply.ID,
+		MessageID:  reply.MessageID,
+		Reply:      reply.Reply,
+		CreatedAt:  reply.CreatedAt,
+		ReplyCount: message.ReplyCount,
+	}, nil
+}
+
+// (c) ROOM EVENTS
+func (s *Store) InsertRoomEvent(_ context.Context, arg pgstore.InsertRoomEventParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ps: the sequence lives on the room (rooms.last_event_seq)
+	room, ok := s.rooms[arg.RoomID]
+	if !ok {
+		return 0, pgx.ErrNoRows
+	}
+
+	room.LastEventSeq++
+	s.rooms[arg.RoomID] = room
+	s.events[arg.RoomID] = append(s.events[arg.RoomID], pgstore.RoomEvent{
+		RoomID:  arg.RoomID,
+		Seq:     room.LastEventSeq,
+		Kind:    arg.Kind,
+		Payload: append([]byte(nil), arg.Payload...),
+	})
+
+	return room.LastEventSeq, nil
+}
+
+func (s *Store) GetRoomEventsSince(_ context.Context, arg pgstore.GetRoomEventsSinceParams) ([]pgstore.RoomEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []pgstore.RoomEvent
+	for _, event := range s.events[arg.RoomID] {
+		if event.Seq > arg.Seq {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// (d) HELPERS
+// now mirrors DEFAULT now() (PostgreSQL keeps microseconds)
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// before reports whether (createdAt, id) < (cursorCreatedAt, cursorID), like a row comparison
+// Ps: PostgreSQL compares uuids byte by byte
+func before(createdAt time.Time, id uuid.UUID, cursorCreatedAt time.Time, cursorID uuid.UUID) bool {
+	if !createdAt.Equal(cursorCreatedAt) {
+		return createdAt.Before(cursorCreatedAt)
+	}
+	return bytes.Compare(id[:], cursorID[:]) < 0
+}
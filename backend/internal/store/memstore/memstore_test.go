@@ -0,0 +1,303 @@
+package memstore_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/memstore"
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// STORE TESTS
+// memstore stands in for PostgreSQL on the handler tests, so it must behave like the queries do
+
+// (a) HELPERS
+func insertRoom(t *testing.T, s *memstore.Store) uuid.UUID {
+	t.Helper()
+
+	roomID, err := s.InsertRoom(context.Background(), pgstore.InsertRoomParams{Theme: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return roomID
+}
+
+func insertMessage(t *testing.T, s *memstore.Store, roomID uuid.UUID) uuid.UUID {
+	t.Helper()
+
+	messageID, err := s.InsertMessage(context.Background(), pgstore.InsertMessageParams{RoomID: roomID, Message: "question", Status: "approved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messageID
+}
+
+func insertEvent(t *testing.T, s *memstore.Store, roomID uuid.UUID, payload []byte) int64 {
+	t.Helper()
+
+	seq, err := s.InsertRoomEvent(context.Background(), pgstore.InsertRoomEventParams{RoomID: roomID, Kind: "message_created", Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return seq
+}
+
+// (b) ROOM EVENTS
+// Each room has its own sequence, starting at 1
+func TestRoomEventSequence(t *testing.T) {
+	ctx := context.Background()
+	s := memstore.New()
+	first, second := insertRoom(t, s), insertRoom(t, s)
+
+	payload := []byte(`{"id":"a"}`)
+	for i, want := range []struct {
+		roomID uuid.UUID
+		seq    int64
+	}{{first, 1}, {first, 2}, {second, 1}, {first, 3}} {
+		if seq := insertEvent(t, s, want.roomID, payload); seq != want.seq {
+			t.Fatalf("event %d: seq = %d, want %d", i, seq, want.seq)
+		}
+	}
+	// Ps: the store keeps its own copy of the payload
+	payload[2] = 'X'
+
+	events, err := s.GetRoomEventsSince(ctx, pgstore.GetRoomEventsSinceParams{RoomID: first, Seq: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 || string(events[0].Payload) != `{"id":"a"}` {
+		t.Fatalf("events = %+v", events)
+	}
+
+	room, err := s.GetRoom(ctx, first)
+	if err != nil || room.LastEventSeq != 3 {
+		t.Fatalf("room = %+v, %v", room, err)
+	}
+}
+
+// (c) REACTIONS
+// A participant counts once per message; repeated calls report no change
+func TestReactionsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := memstore.New()
+	roomID := insertRoom(t, s)
+	messageID := insertMessage(t, s, roomID)
+	alice, bob := uuid.New(), uuid.New()
+
+	steps := []struct {
+		react       bool
+		participant uuid.UUID
+		count       int64
+		changed     bool
+	}{
+		{true, alice, 1, true},
+		{true, alice, 1, false},
+		{true, bob, 2, true},
+		{false, alice, 1, true},
+		{false, alice, 1, false},
+		{false, uuid.New(), 1, false},
+	}
+	for i, step := range steps {
+		var count int64
+		var changed bool
+		var err error
+		if step.react {
+			var row pgstore.ReactToMessageRow
+			row, err = s.ReactToMessage(ctx, pgstore.ReactToMessageParams{MessageID: messageID, ParticipantID: step.participant})
+			count, changed = row.ReactionCount, row.Changed
+		} else {
+			var row pgstore.RemoveReactionFromMessageRow
+			row, err = s.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{MessageID: messageID, ParticipantID: step.participant})
+			count, changed = row.ReactionCount, row.Changed
+		}
+		if err != nil || count != step.count || changed != step.changed {
+			t.Fatalf("step %d: count = %d, changed = %t, err = %v; want %d %t", i, count, changed, err, step.count, step.changed)
+		}
+	}
+
+	for participant, want := range map[uuid.UUID]bool{alice: false, bob: true} {
+		reacted, err := s.HasParticipantReacted(ctx, pgstore.HasParticipantReactedParams{MessageID: messageID, ParticipantID: participant})
+		if err != nil || reacted != want {
+			t.Fatalf("HasParticipantReacted = %t, %v; want %t", reacted, err, want)
+		}
+	}
+	messageIDs, err := s.GetParticipantRoomReactions(ctx, pgstore.GetParticipantRoomReactionsParams{RoomID: roomID, ParticipantID: bob})
+	if err != nil || len(messageIDs) != 1 || messageIDs[0] != messageID {
+		t.Fatalf("GetParticipantRoomReactions = %v, %v", messageIDs, err)
+	}
+}
+
+// (d) NOT FOUND
+// Lookups and updates of missing rows fail like pgx does; foreign keys are enforced
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	s := memstore.New()
+	missing := uuid.New()
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"GetRoom", func() error { _, err := s.GetRoom(ctx, missing); return err }, pgx.ErrNoRows},
+		{"UpdateRoomStatus", func() error {
+			_, err := s.UpdateRoomStatus(ctx, pgstore.UpdateRoomStatusParams{ID: missing, Status: "closed"})
+			return err
+		}, pgx.ErrNoRows},
+		{"UpdateRoomModeration", func() error {
+			_, err := s.UpdateRoomModeration(ctx, pgstore.UpdateRoomModerationParams{ID: missing, Moderated: true})
+			return err
+		}, pgx.ErrNoRows},
+		{"GetMessage", func() error { _, err := s.GetMessage(ctx, missing); return err }, pgx.ErrNoRows},
+		{"InsertMessage", func() error {
+			_, err := s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: missing, Message: "question"})
+			return err
+		}, memstore.ErrRoomDoesNotExist},
+		{"ReactToMessage", func() error {
+			_, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{MessageID: missing, ParticipantID: uuid.New()})
+			return err
+		}, pgx.ErrNoRows},
+		{"RemoveReactionFromMessage", func() error {
+			_, err := s.RemoveReactionFromMessage(ctx, pgstore.RemoveReactionFromMessageParams{MessageID: missing, ParticipantID: uuid.New()})
+			return err
+		}, pgx.ErrNoRows},
+		{"GetAnswer", func() error { _, err := s.GetAnswer(ctx, missing); return err }, pgx.ErrNoRows},
+		{"InsertAnswer", func() error {
+			_, err := s.InsertAnswer(ctx, pgstore.InsertAnswerParams{MessageID: missing, Answer: "answer"})
+			return err
+		}, memstore.ErrMessageDoesNotExist},
+		{"UpdateAnswer", func() error {
+			_, err := s.UpdateAnswer(ctx, pgstore.UpdateAnswerParams{ID: missing, Answer: "answer"})
+			return err
+		}, pgx.ErrNoRows},
+		{"InsertReply", func() error {
+			_, err := s.InsertReply(ctx, pgstore.InsertReplyParams{MessageID: missing, Reply: "+1"})
+			return err
+		}, pgx.ErrNoRows},
+		{"InsertRoomEvent", func() error {
+			_, err := s.InsertRoomEvent(ctx, pgstore.InsertRoomEventParams{RoomID: missing, Kind: "message_created"})
+			return err
+		}, pgx.ErrNoRows},
+		// Ps: :exec queries matching no row are not errors
+		{"MarkMessageAsAnswered", func() error { return s.MarkMessageAsAnswered(ctx, missing) }, nil},
+		{"DeleteMessage", func() error { return s.DeleteMessage(ctx, missing) }, nil},
+		{"DeleteAnswer", func() error { return s.DeleteAnswer(ctx, missing) }, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	rows, err := s.ModerateMessage(ctx, pgstore.ModerateMessageParams{ID: missing, Status: "approved"})
+	if rows != 0 || err != nil {
+		t.Fatalf("ModerateMessage = %d, %v; want 0 rows", rows, err)
+	}
+}
+
+// Deleting a message deletes its reactions, answers and replies (ON DELETE CASCADE)
+func TestDeleteMessageCascades(t *testing.T) {
+	ctx := context.Background()
+	s := memstore.New()
+	roomID := insertRoom(t, s)
+	messageID := insertMessage(t, s, roomID)
+	participant := uuid.New()
+
+	if _, err := s.ReactToMessage(ctx, pgstore.ReactToMessageParams{MessageID: messageID, ParticipantID: participant}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := s.InsertAnswer(ctx, pgstore.InsertAnswerParams{MessageID: messageID, Answer: "answer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertReply(ctx, pgstore.InsertReplyParams{MessageID: messageID, Reply: "+1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteMessage(ctx, messageID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetAnswer(ctx, answer.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("answer after delete: %v", err)
+	}
+	if replies, err := s.GetMessageReplies(ctx, messageID); err != nil || len(replies) != 0 {
+		t.Fatalf("replies after delete = %v, %v", replies, err)
+	}
+	if reacted, err := s.HasParticipantReacted(ctx, pgstore.HasParticipantReactedParams{MessageID: messageID, ParticipantID: participant}); err != nil || reacted {
+		t.Fatalf("reaction after delete = %t, %v", reacted, err)
+	}
+}
+
+// (e) CONCURRENCY
+// Concurrent writers never share a sequence number nor lose a reaction or a reply (run with -race)
+func TestConcurrentAccess(t *testing.T) {
+	const writers = 50
+	ctx := context.Background()
+	s := memstore.New()
+	roomID := insertRoom(t, s)
+	messageID := insertMessage(t, s, roomID)
+
+	seqs := make([]int64, writers)
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			seq, err := s.InsertRoomEvent(ctx, pgstore.InsertRoomEventParams{RoomID: roomID, Kind: "message_created"})
+			if err == nil {
+				seqs[i] = seq
+				_, err = s.ReactToMessage(ctx, pgstore.ReactToMessageParams{MessageID: messageID, ParticipantID: uuid.New()})
+			}
+			if err == nil {
+				_, err = s.InsertReply(ctx, pgstore.InsertReplyParams{MessageID: messageID, Reply: "+1"})
+			}
+			if err == nil {
+				_, err = s.InsertMessage(ctx, pgstore.InsertMessageParams{RoomID: roomID, Message: "question", Status: "approved"})
+			}
+			if err == nil {
+				_, err = s.GetRoomMessagesNewest(ctx, pgstore.GetRoomMessagesNewestParams{RoomID: roomID, PageLimit: 10})
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// i. Sequence numbers 1..writers, each used once
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+	for i, seq := range seqs {
+		if seq != int64(i+1) {
+			t.Fatalf("seqs = %v", seqs)
+		}
+	}
+
+	// ii. Counters
+	message, err := s.GetMessage(ctx, messageID)
+	if err != nil || message.ReactionCount != writers || message.ReplyCount != writers {
+		t.Fatalf("message = %+v, %v", message, err)
+	}
+	messages, err := s.GetRoomMessagesNewest(ctx, pgstore.GetRoomMessagesNewestParams{RoomID: roomID, PageLimit: 100})
+	if err != nil || len(messages) != writers+1 {
+		t.Fatalf("%d messages, %v; want %d", len(messages), err, writers+1)
+	}
+}
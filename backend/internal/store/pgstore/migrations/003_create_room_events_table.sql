@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "last_event_seq" BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS room_events (
+    "room_id" uuid                            NOT NULL,
+    "seq"     BIGINT                          NOT NULL,
+    "kind"    VARCHAR(255)                    NOT NULL,
+    "payload" JSONB                           NOT NULL,
+
+    PRIMARY KEY (room_id, seq),
+    FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS room_events;
+
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "last_event_seq";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,28 @@
+-- Write your migrate up statements here
+CREATE TABLE IF NOT EXISTS message_reactions (
+    "message_id"     uuid                            NOT NULL,
+    "participant_id" uuid                            NOT NULL,
+
+    PRIMARY KEY (message_id, participant_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Anonymous reactions cannot be attributed to a participant: keep their count,
+-- but fix the ones driven below zero before enforcing it
+UPDATE messages
+SET
+    reaction_count = 0
+WHERE
+    reaction_count < 0;
+
+ALTER TABLE messages
+    ADD CONSTRAINT messages_reaction_count_check CHECK (reaction_count >= 0);
+
+---- create above / drop below ----
+ALTER TABLE messages
+    DROP CONSTRAINT IF EXISTS messages_reaction_count_check;
+
+DROP TABLE IF EXISTS message_reactions;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+-- SHA-256 of the host secret returned once by POST /api/rooms
+-- Ps: rooms created before this migration have no host
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "host_secret_hash" BYTEA NOT NULL DEFAULT ''::BYTEA;
+
+---- create above / drop below ----
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "host_secret_hash";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,36 @@
+-- Write your migrate up statements here
+-- Creation time of rooms and messages (cursor pagination and "newest" ordering)
+-- Ps: rows created before this migration get the time it runs
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "created_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS "created_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- One index per sort mode, matching its ORDER BY
+CREATE INDEX IF NOT EXISTS rooms_created_at_idx
+    ON rooms ("created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS messages_room_newest_idx
+    ON messages ("room_id", "created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS messages_room_most_reacted_idx
+    ON messages ("room_id", "reaction_count" DESC, "created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS messages_room_unanswered_first_idx
+    ON messages ("room_id", "answered", "created_at" DESC, "id" DESC);
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS messages_room_unanswered_first_idx;
+DROP INDEX IF EXISTS messages_room_most_reacted_idx;
+DROP INDEX IF EXISTS messages_room_newest_idx;
+DROP INDEX IF EXISTS rooms_created_at_idx;
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS "created_at";
+
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "created_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,31 @@
+-- Write your migrate up statements here
+-- Audit columns (created_at comes from 006)
+-- (a) updated_at: last change made by the API (theme, answer, reactions)
+-- Ps: rows created before this migration start with their creation time
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE rooms SET updated_at = created_at;
+
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE messages SET updated_at = created_at;
+
+-- (b) answered_at: when the host marked the message as answered (NULL while unanswered)
+-- Ps: messages answered before this migration keep NULL, the time is unknown
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS "answered_at" TIMESTAMPTZ;
+
+---- create above / drop below ----
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS "answered_at";
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS "updated_at";
+
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "updated_at";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
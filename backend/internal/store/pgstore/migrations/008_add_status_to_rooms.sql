@@ -0,0 +1,15 @@
+-- Write your migrate up statements here
+-- Room lifecycle
+-- (a) open: accepts questions and reactions
+-- (b) closed: no new questions or reactions, the host can still moderate
+-- (c) archived: read-only and hidden from the room list
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "status" VARCHAR(16) NOT NULL DEFAULT 'open'
+        CHECK ("status" IN ('open', 'closed', 'archived'));
+
+---- create above / drop below ----
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "status";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,20 @@
+-- Write your migrate up statements here
+-- Written answers posted by the host (one or more per message)
+CREATE TABLE IF NOT EXISTS answers (
+    "id"         uuid            PRIMARY KEY     NOT NULL    DEFAULT gen_random_uuid(),
+    "message_id" uuid                            NOT NULL,
+    "answer"     TEXT                            NOT NULL,
+    "created_at" TIMESTAMPTZ                     NOT NULL    DEFAULT now(),
+    "updated_at" TIMESTAMPTZ                     NOT NULL    DEFAULT now(),
+
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS answers_message_id_idx
+    ON answers ("message_id", "created_at", "id");
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS answers;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
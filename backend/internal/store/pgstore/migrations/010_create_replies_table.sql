@@ -0,0 +1,26 @@
+-- Write your migrate up statements here
+-- Follow-up replies on a message ("+1, also on Windows")
+-- Ps: messages.reply_count is kept by InsertReply, like reaction_count
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS "reply_count" BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS replies (
+    "id"         uuid            PRIMARY KEY     NOT NULL    DEFAULT gen_random_uuid(),
+    "message_id" uuid                            NOT NULL,
+    "reply"      VARCHAR(255)                    NOT NULL,
+    "created_at" TIMESTAMPTZ                     NOT NULL    DEFAULT now(),
+
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS replies_message_id_idx
+    ON replies ("message_id", "created_at", "id");
+
+---- create above / drop below ----
+DROP TABLE IF EXISTS replies;
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS "reply_count";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
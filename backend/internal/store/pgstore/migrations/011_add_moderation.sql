@@ -0,0 +1,27 @@
+-- Write your migrate up statements here
+-- Moderation queue
+-- (a) rooms.moderated: new messages wait for the host approval
+ALTER TABLE rooms
+    ADD COLUMN IF NOT EXISTS "moderated" BOOLEAN NOT NULL DEFAULT false;
+
+-- (b) messages.status: only approved messages are shown to participants
+-- Ps: messages created before this migration were already public
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS "status" VARCHAR(16) NOT NULL DEFAULT 'approved'
+        CHECK ("status" IN ('pending', 'approved', 'rejected'));
+
+CREATE INDEX IF NOT EXISTS messages_room_pending_idx
+    ON messages ("room_id", "created_at", "id")
+    WHERE "status" = 'pending';
+
+---- create above / drop below ----
+DROP INDEX IF EXISTS messages_room_pending_idx;
+
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS "status";
+
+ALTER TABLE rooms
+    DROP COLUMN IF EXISTS "moderated";
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
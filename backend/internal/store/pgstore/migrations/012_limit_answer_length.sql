@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+-- Answers are bounded like messages and replies (events carrying them go through pg_notify)
+-- Ps: longer answers (none expected) are truncated
+ALTER TABLE answers
+    ALTER COLUMN "answer" TYPE VARCHAR(1000) USING left("answer", 1000);
+
+---- create above / drop below ----
+ALTER TABLE answers
+    ALTER COLUMN "answer" TYPE TEXT;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -5,18 +5,58 @@
 package pgstore
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
+type Answer struct {
+	ID        uuid.UUID
+	MessageID uuid.UUID
+	Answer    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 type Message struct {
 	ID            uuid.UUID
 	RoomID        uuid.UUID
 	Message       string
 	ReactionCount int64
 	Answered      bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	AnsweredAt    *time.Time
+	ReplyCount    int64
+	Status        string
+}
+
+type MessageReaction struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+type Reply struct {
+	ID        uuid.UUID
+	MessageID uuid.UUID
+	Reply     string
+	CreatedAt time.Time
 }
 
 type Room struct {
-	ID    uuid.UUID
-	Theme string
+	ID             uuid.UUID
+	Theme          string
+	LastEventSeq   int64
+	HostSecretHash []byte
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Status         string
+	Moderated      bool
+}
+
+type RoomEvent struct {
+	RoomID  uuid.UUID
+	Seq     int64
+	Kind    string
+	Payload []byte
 }
@@ -7,13 +7,93 @@ package pgstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const deleteAnswer = `-- name: DeleteAnswer :exec
+DELETE FROM answers
+WHERE
+    id = $1
+`
+
+func (q *Queries) DeleteAnswer(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteAnswer, id)
+	return err
+}
+
+const deleteMessage = `-- name: DeleteMessage :exec
+DELETE FROM messages
+WHERE
+    id = $1
+`
+
+func (q *Queries) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteMessage, id)
+	return err
+}
+
+const getAnswer = `-- name: GetAnswer :one
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    id = $1
+`
+
+func (q *Queries) GetAnswer(ctx context.Context, id uuid.UUID) (Answer, error) {
+	row := q.db.QueryRow(ctx, getAnswer, id)
+	var i Answer
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.Answer,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getAnswersByMessageIDs = `-- name: GetAnswersByMessageIDs :many
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    message_id = ANY($1::UUID[])
+ORDER BY "created_at", "id"
+`
+
+// Answers of a page of messages, in one round trip
+func (q *Queries) GetAnswersByMessageIDs(ctx context.Context, messageIds []uuid.UUID) ([]Answer, error) {
+	rows, err := q.db.Query(ctx, getAnswersByMessageIDs, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Answer
+	for rows.Next() {
+		var i Answer
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Answer,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getMessage = `-- name: GetMessage :one
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
 FROM messages
 WHERE
     id = $1
@@ -28,13 +108,121 @@ func (q *Queries) GetMessage(ctx context.Context, id uuid.UUID) (Message, error)
 		&i.Message,
 		&i.ReactionCount,
 		&i.Answered,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.AnsweredAt,
+		&i.ReplyCount,
+		&i.Status,
 	)
 	return i, err
 }
 
+const getMessageAnswers = `-- name: GetMessageAnswers :many
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    message_id = $1
+ORDER BY "created_at", "id"
+`
+
+func (q *Queries) GetMessageAnswers(ctx context.Context, messageID uuid.UUID) ([]Answer, error) {
+	rows, err := q.db.Query(ctx, getMessageAnswers, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Answer
+	for rows.Next() {
+		var i Answer
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Answer,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageReplies = `-- name: GetMessageReplies :many
+SELECT
+    "id", "message_id", "reply", "created_at"
+FROM replies
+WHERE
+    message_id = $1
+ORDER BY "created_at", "id"
+`
+
+func (q *Queries) GetMessageReplies(ctx context.Context, messageID uuid.UUID) ([]Reply, error) {
+	rows, err := q.db.Query(ctx, getMessageReplies, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Reply
+	for rows.Next() {
+		var i Reply
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Reply,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getParticipantRoomReactions = `-- name: GetParticipantRoomReactions :many
+SELECT
+    r."message_id"
+FROM message_reactions r
+JOIN messages m ON m.id = r.message_id
+WHERE
+    m.room_id = $1 AND r.participant_id = $2
+`
+
+type GetParticipantRoomReactionsParams struct {
+	RoomID        uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+func (q *Queries) GetParticipantRoomReactions(ctx context.Context, arg GetParticipantRoomReactionsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, getParticipantRoomReactions, arg.RoomID, arg.ParticipantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var message_id uuid.UUID
+		if err := rows.Scan(&message_id); err != nil {
+			return nil, err
+		}
+		items = append(items, message_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRoom = `-- name: GetRoom :one
 SELECT
-    "id", "theme"
+    "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
 FROM rooms
 WHERE id = $1
 `
@@ -42,20 +230,221 @@ WHERE id = $1
 func (q *Queries) GetRoom(ctx context.Context, id uuid.UUID) (Room, error) {
 	row := q.db.QueryRow(ctx, getRoom, id)
 	var i Room
-	err := row.Scan(&i.ID, &i.Theme)
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.LastEventSeq,
+		&i.HostSecretHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.Moderated,
+	)
 	return i, err
 }
 
-const getRoomMessages = `-- name: GetRoomMessages :many
+const getRoomEventsSince = `-- name: GetRoomEventsSince :many
+SELECT
+    "room_id", "seq", "kind", "payload"
+FROM room_events
+WHERE
+    room_id = $1 AND seq > $2
+ORDER BY seq
+`
+
+type GetRoomEventsSinceParams struct {
+	RoomID uuid.UUID
+	Seq    int64
+}
+
+func (q *Queries) GetRoomEventsSince(ctx context.Context, arg GetRoomEventsSinceParams) ([]RoomEvent, error) {
+	rows, err := q.db.Query(ctx, getRoomEventsSince, arg.RoomID, arg.Seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RoomEvent
+	for rows.Next() {
+		var i RoomEvent
+		if err := rows.Scan(
+			&i.RoomID,
+			&i.Seq,
+			&i.Kind,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesMostReacted = `-- name: GetRoomMessagesMostReacted :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = $1
+    AND "status" = 'approved'
+    AND (
+        NOT $2::BOOLEAN
+        OR ("reaction_count", "created_at", "id") < ($3::BIGINT, $4::TIMESTAMPTZ, $5::UUID)
+    )
+ORDER BY "reaction_count" DESC, "created_at" DESC, "id" DESC
+LIMIT $6
+`
+
+type GetRoomMessagesMostReactedParams struct {
+	RoomID              uuid.UUID
+	HasCursor           bool
+	CursorReactionCount int64
+	CursorCreatedAt     time.Time
+	CursorID            uuid.UUID
+	PageLimit           int32
+}
+
+// Most reacted messages first (newest first on ties), starting after the cursor (reaction_count, created_at, id)
+func (q *Queries) GetRoomMessagesMostReacted(ctx context.Context, arg GetRoomMessagesMostReactedParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesMostReacted,
+		arg.RoomID,
+		arg.HasCursor,
+		arg.CursorReactionCount,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AnsweredAt,
+			&i.ReplyCount,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesNewest = `-- name: GetRoomMessagesNewest :many
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = $1
+    AND "status" = 'approved'
+    AND (
+        NOT $2::BOOLEAN
+        OR ("created_at", "id") < ($3::TIMESTAMPTZ, $4::UUID)
+    )
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $5
+`
+
+type GetRoomMessagesNewestParams struct {
+	RoomID          uuid.UUID
+	HasCursor       bool
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	PageLimit       int32
+}
+
+// Newest messages first, starting after the cursor (created_at, id) when has_cursor is set
+func (q *Queries) GetRoomMessagesNewest(ctx context.Context, arg GetRoomMessagesNewestParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesNewest,
+		arg.RoomID,
+		arg.HasCursor,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AnsweredAt,
+			&i.ReplyCount,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomMessagesUnansweredFirst = `-- name: GetRoomMessagesUnansweredFirst :many
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
 FROM messages
 WHERE
     room_id = $1
+    AND "status" = 'approved'
+    AND (
+        NOT $2::BOOLEAN
+        OR "answered" > $3::BOOLEAN
+        OR (
+            "answered" = $3::BOOLEAN
+            AND ("created_at", "id") < ($4::TIMESTAMPTZ, $5::UUID)
+        )
+    )
+ORDER BY "answered" ASC, "created_at" DESC, "id" DESC
+LIMIT $6
 `
 
-func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Message, error) {
-	rows, err := q.db.Query(ctx, getRoomMessages, roomID)
+type GetRoomMessagesUnansweredFirstParams struct {
+	RoomID          uuid.UUID
+	HasCursor       bool
+	CursorAnswered  bool
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	PageLimit       int32
+}
+
+// Unanswered messages first, newest first inside each group, starting after the cursor (answered, created_at, id)
+// Ps: answered goes ASC and the rest DESC, so the cursor cannot be a single row comparison
+func (q *Queries) GetRoomMessagesUnansweredFirst(ctx context.Context, arg GetRoomMessagesUnansweredFirstParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomMessagesUnansweredFirst,
+		arg.RoomID,
+		arg.HasCursor,
+		arg.CursorAnswered,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +458,11 @@ func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Mess
 			&i.Message,
 			&i.ReactionCount,
 			&i.Answered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AnsweredAt,
+			&i.ReplyCount,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -80,14 +474,77 @@ func (q *Queries) GetRoomMessages(ctx context.Context, roomID uuid.UUID) ([]Mess
 	return items, nil
 }
 
-const getRooms = `-- name: GetRooms :many
+const getRoomPendingMessages = `-- name: GetRoomPendingMessages :many
 SELECT
-    "id", "theme"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = $1 AND "status" = 'pending'
+ORDER BY "created_at", "id"
+`
+
+// Moderation queue, oldest first
+func (q *Queries) GetRoomPendingMessages(ctx context.Context, roomID uuid.UUID) ([]Message, error) {
+	rows, err := q.db.Query(ctx, getRoomPendingMessages, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Message,
+			&i.ReactionCount,
+			&i.Answered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AnsweredAt,
+			&i.ReplyCount,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoomsPage = `-- name: GetRoomsPage :many
+SELECT
+    "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
 FROM rooms
+WHERE
+    "status" <> 'archived'
+    AND (
+        NOT $1::BOOLEAN
+        OR ("created_at", "id") < ($2::TIMESTAMPTZ, $3::UUID)
+    )
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT $4
 `
 
-func (q *Queries) GetRooms(ctx context.Context) ([]Room, error) {
-	rows, err := q.db.Query(ctx, getRooms)
+type GetRoomsPageParams struct {
+	HasCursor       bool
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	PageLimit       int32
+}
+
+// Newest rooms first, starting after the cursor (created_at, id) when has_cursor is set
+// Ps: archived rooms are not listed
+func (q *Queries) GetRoomsPage(ctx context.Context, arg GetRoomsPageParams) ([]Room, error) {
+	rows, err := q.db.Query(ctx, getRoomsPage,
+		arg.HasCursor,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +552,16 @@ func (q *Queries) GetRooms(ctx context.Context) ([]Room, error) {
 	var items []Room
 	for rows.Next() {
 		var i Room
-		if err := rows.Scan(&i.ID, &i.Theme); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Theme,
+			&i.LastEventSeq,
+			&i.HostSecretHash,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.Moderated,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -106,80 +572,365 @@ func (q *Queries) GetRooms(ctx context.Context) ([]Room, error) {
 	return items, nil
 }
 
+const hasParticipantReacted = `-- name: HasParticipantReacted :one
+SELECT EXISTS (
+    SELECT 1
+    FROM message_reactions
+    WHERE
+        message_id = $1 AND participant_id = $2
+)
+`
+
+type HasParticipantReactedParams struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+func (q *Queries) HasParticipantReacted(ctx context.Context, arg HasParticipantReactedParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasParticipantReacted, arg.MessageID, arg.ParticipantID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const insertAnswer = `-- name: InsertAnswer :one
+INSERT INTO answers
+    ( "message_id", "answer" ) VALUES
+    ( $1, $2 )
+RETURNING "id", "message_id", "answer", "created_at", "updated_at"
+`
+
+type InsertAnswerParams struct {
+	MessageID uuid.UUID
+	Answer    string
+}
+
+func (q *Queries) InsertAnswer(ctx context.Context, arg InsertAnswerParams) (Answer, error) {
+	row := q.db.QueryRow(ctx, insertAnswer, arg.MessageID, arg.Answer)
+	var i Answer
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.Answer,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const insertMessage = `-- name: InsertMessage :one
 INSERT INTO messages
-    ( "room_id", "message" ) VALUES
-    ( $1, $2 )
+    ( "room_id", "message", "status" ) VALUES
+    ( $1, $2, $3 )
 RETURNING "id"
 `
 
 type InsertMessageParams struct {
 	RoomID  uuid.UUID
 	Message string
+	Status  string
 }
 
 func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertMessage, arg.RoomID, arg.Message)
+	row := q.db.QueryRow(ctx, insertMessage, arg.RoomID, arg.Message, arg.Status)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
+const insertReply = `-- name: InsertReply :one
+WITH parent AS (
+    UPDATE messages
+    SET
+        reply_count = reply_count + 1,
+        updated_at = now()
+    WHERE
+        id = $1
+    RETURNING "id", "reply_count"
+), new_reply AS (
+    INSERT INTO replies
+        ( "message_id", "reply" )
+    SELECT
+        id, $2::VARCHAR
+    FROM parent
+    RETURNING "id", "message_id", "reply", "created_at"
+)
+SELECT
+    r."id", r."message_id", r."reply", r."created_at", p."reply_count"
+FROM new_reply r, parent p
+`
+
+type InsertReplyParams struct {
+	MessageID uuid.UUID
+	Reply     string
+}
+
+type InsertReplyRow struct {
+	ID         uuid.UUID
+	MessageID  uuid.UUID
+	Reply      string
+	CreatedAt  time.Time
+	ReplyCount int64
+}
+
+// Insert a reply and bump the reply count of its message (no row when the message does not exist)
+func (q *Queries) InsertReply(ctx context.Context, arg InsertReplyParams) (InsertReplyRow, error) {
+	row := q.db.QueryRow(ctx, insertReply, arg.MessageID, arg.Reply)
+	var i InsertReplyRow
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.Reply,
+		&i.CreatedAt,
+		&i.ReplyCount,
+	)
+	return i, err
+}
+
 const insertRoom = `-- name: InsertRoom :one
 INSERT INTO rooms
-    ( "theme" ) VALUES
-    ( $1 )
+    ( "theme", "host_secret_hash", "moderated" ) VALUES
+    ( $1, $2, $3 )
 RETURNING "id"
 `
 
-func (q *Queries) InsertRoom(ctx context.Context, theme string) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertRoom, theme)
+type InsertRoomParams struct {
+	Theme          string
+	HostSecretHash []byte
+	Moderated      bool
+}
+
+func (q *Queries) InsertRoom(ctx context.Context, arg InsertRoomParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertRoom, arg.Theme, arg.HostSecretHash, arg.Moderated)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
+const insertRoomEvent = `-- name: InsertRoomEvent :one
+WITH next_event AS (
+    UPDATE rooms
+    SET
+        last_event_seq = last_event_seq + 1
+    WHERE
+        id = $1
+    RETURNING last_event_seq
+)
+INSERT INTO room_events
+    ( "room_id", "seq", "kind", "payload" )
+SELECT
+    $1, last_event_seq, $2::VARCHAR, $3::JSONB
+FROM next_event
+RETURNING "seq"
+`
+
+type InsertRoomEventParams struct {
+	RoomID  uuid.UUID
+	Kind    string
+	Payload []byte
+}
+
+func (q *Queries) InsertRoomEvent(ctx context.Context, arg InsertRoomEventParams) (int64, error) {
+	row := q.db.QueryRow(ctx, insertRoomEvent, arg.RoomID, arg.Kind, arg.Payload)
+	var seq int64
+	err := row.Scan(&seq)
+	return seq, err
+}
+
 const markMessageAsAnswered = `-- name: MarkMessageAsAnswered :exec
 UPDATE messages
 SET
-    answered = true
+    answered = true,
+    answered_at = COALESCE(answered_at, now()),
+    updated_at = now()
 WHERE
     id = $1
 `
 
+// Ps: answering again keeps the first answered_at
 func (q *Queries) MarkMessageAsAnswered(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.Exec(ctx, markMessageAsAnswered, id)
 	return err
 }
 
+const moderateMessage = `-- name: ModerateMessage :execrows
+UPDATE messages
+SET
+    status = $1::VARCHAR,
+    updated_at = now()
+WHERE
+    id = $2 AND "status" = 'pending'
+`
+
+type ModerateMessageParams struct {
+	Status string
+	ID     uuid.UUID
+}
+
+// Approve or reject a pending message (0 rows when it is not pending anymore)
+func (q *Queries) ModerateMessage(ctx context.Context, arg ModerateMessageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, moderateMessage, arg.Status, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const reactToMessage = `-- name: ReactToMessage :one
+WITH new_reaction AS (
+    INSERT INTO message_reactions
+        ( "message_id", "participant_id" ) VALUES
+        ( $1, $2 )
+    ON CONFLICT DO NOTHING
+    RETURNING "message_id"
+)
 UPDATE messages
 SET
-    reaction_count = reaction_count + 1
+    reaction_count = reaction_count + (SELECT COUNT(*) FROM new_reaction),
+    updated_at = CASE WHEN EXISTS (SELECT 1 FROM new_reaction) THEN now() ELSE updated_at END
 WHERE
     id = $1
-RETURNING reaction_count
+RETURNING reaction_count, EXISTS (SELECT 1 FROM new_reaction) AS changed
 `
 
-func (q *Queries) ReactToMessage(ctx context.Context, id uuid.UUID) (int64, error) {
-	row := q.db.QueryRow(ctx, reactToMessage, id)
-	var reaction_count int64
-	err := row.Scan(&reaction_count)
-	return reaction_count, err
+type ReactToMessageParams struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+type ReactToMessageRow struct {
+	ReactionCount int64
+	Changed       bool
+}
+
+// Add the reaction of a participant (changed is false when it was already there)
+func (q *Queries) ReactToMessage(ctx context.Context, arg ReactToMessageParams) (ReactToMessageRow, error) {
+	row := q.db.QueryRow(ctx, reactToMessage, arg.MessageID, arg.ParticipantID)
+	var i ReactToMessageRow
+	err := row.Scan(&i.ReactionCount, &i.Changed)
+	return i, err
 }
 
 const removeReactionFromMessage = `-- name: RemoveReactionFromMessage :one
+WITH removed_reaction AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_id = $1 AND participant_id = $2
+    RETURNING "message_id"
+)
 UPDATE messages
 SET
-    reaction_count = reaction_count - 1
+    reaction_count = reaction_count - (SELECT COUNT(*) FROM removed_reaction),
+    updated_at = CASE WHEN EXISTS (SELECT 1 FROM removed_reaction) THEN now() ELSE updated_at END
 WHERE
     id = $1
-RETURNING reaction_count
+RETURNING reaction_count, EXISTS (SELECT 1 FROM removed_reaction) AS changed
 `
 
-func (q *Queries) RemoveReactionFromMessage(ctx context.Context, id uuid.UUID) (int64, error) {
-	row := q.db.QueryRow(ctx, removeReactionFromMessage, id)
-	var reaction_count int64
-	err := row.Scan(&reaction_count)
-	return reaction_count, err
+type RemoveReactionFromMessageParams struct {
+	MessageID     uuid.UUID
+	ParticipantID uuid.UUID
+}
+
+type RemoveReactionFromMessageRow struct {
+	ReactionCount int64
+	Changed       bool
+}
+
+// Remove the reaction of a participant (changed is false when there was none)
+func (q *Queries) RemoveReactionFromMessage(ctx context.Context, arg RemoveReactionFromMessageParams) (RemoveReactionFromMessageRow, error) {
+	row := q.db.QueryRow(ctx, removeReactionFromMessage, arg.MessageID, arg.ParticipantID)
+	var i RemoveReactionFromMessageRow
+	err := row.Scan(&i.ReactionCount, &i.Changed)
+	return i, err
+}
+
+const updateAnswer = `-- name: UpdateAnswer :one
+UPDATE answers
+SET
+    answer = $1,
+    updated_at = now()
+WHERE
+    id = $2
+RETURNING "id", "message_id", "answer", "created_at", "updated_at"
+`
+
+type UpdateAnswerParams struct {
+	Answer string
+	ID     uuid.UUID
+}
+
+func (q *Queries) UpdateAnswer(ctx context.Context, arg UpdateAnswerParams) (Answer, error) {
+	row := q.db.QueryRow(ctx, updateAnswer, arg.Answer, arg.ID)
+	var i Answer
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.Answer,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateRoomModeration = `-- name: UpdateRoomModeration :one
+UPDATE rooms
+SET
+    moderated = $1,
+    updated_at = now()
+WHERE
+    id = $2
+RETURNING "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
+`
+
+type UpdateRoomModerationParams struct {
+	Moderated bool
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateRoomModeration(ctx context.Context, arg UpdateRoomModerationParams) (Room, error) {
+	row := q.db.QueryRow(ctx, updateRoomModeration, arg.Moderated, arg.ID)
+	var i Room
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.LastEventSeq,
+		&i.HostSecretHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.Moderated,
+	)
+	return i, err
+}
+
+const updateRoomStatus = `-- name: UpdateRoomStatus :one
+UPDATE rooms
+SET
+    status = $1::VARCHAR,
+    updated_at = now()
+WHERE
+    id = $2
+RETURNING "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
+`
+
+type UpdateRoomStatusParams struct {
+	Status string
+	ID     uuid.UUID
+}
+
+func (q *Queries) UpdateRoomStatus(ctx context.Context, arg UpdateRoomStatusParams) (Room, error) {
+	row := q.db.QueryRow(ctx, updateRoomStatus, arg.Status, arg.ID)
+	var i Room
+	err := row.Scan(
+		&i.ID,
+		&i.Theme,
+		&i.LastEventSeq,
+		&i.HostSecretHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.Moderated,
+	)
+	return i, err
 }
@@ -1,59 +1,287 @@
 -- name: GetRoom :one
 SELECT
-    "id", "theme"
+    "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
 FROM rooms
 WHERE id = $1;
 
--- name: GetRooms :many
+-- name: GetRoomsPage :many
+-- Newest rooms first, starting after the cursor (created_at, id) when has_cursor is set
+-- Ps: archived rooms are not listed
 SELECT
-    "id", "theme"
-FROM rooms;
+    "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated"
+FROM rooms
+WHERE
+    "status" <> 'archived'
+    AND (
+        NOT @has_cursor::BOOLEAN
+        OR ("created_at", "id") < (@cursor_created_at::TIMESTAMPTZ, @cursor_id::UUID)
+    )
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT @page_limit;
 
 -- name: InsertRoom :one
 INSERT INTO rooms
-    ( "theme" ) VALUES
-    ( $1 )
+    ( "theme", "host_secret_hash", "moderated" ) VALUES
+    ( $1, $2, $3 )
 RETURNING "id";
 
+-- name: UpdateRoomStatus :one
+UPDATE rooms
+SET
+    status = @status::VARCHAR,
+    updated_at = now()
+WHERE
+    id = @id
+RETURNING "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated";
+
+-- name: UpdateRoomModeration :one
+UPDATE rooms
+SET
+    moderated = @moderated,
+    updated_at = now()
+WHERE
+    id = @id
+RETURNING "id", "theme", "last_event_seq", "host_secret_hash", "created_at", "updated_at", "status", "moderated";
+
 -- name: GetMessage :one
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
 FROM messages
 WHERE
     id = $1;
 
--- name: GetRoomMessages :many
+-- name: GetRoomMessagesNewest :many
+-- Newest messages first, starting after the cursor (created_at, id) when has_cursor is set
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = @room_id
+    AND "status" = 'approved'
+    AND (
+        NOT @has_cursor::BOOLEAN
+        OR ("created_at", "id") < (@cursor_created_at::TIMESTAMPTZ, @cursor_id::UUID)
+    )
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT @page_limit;
+
+-- name: GetRoomMessagesMostReacted :many
+-- Most reacted messages first (newest first on ties), starting after the cursor (reaction_count, created_at, id)
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = @room_id
+    AND "status" = 'approved'
+    AND (
+        NOT @has_cursor::BOOLEAN
+        OR ("reaction_count", "created_at", "id") < (@cursor_reaction_count::BIGINT, @cursor_created_at::TIMESTAMPTZ, @cursor_id::UUID)
+    )
+ORDER BY "reaction_count" DESC, "created_at" DESC, "id" DESC
+LIMIT @page_limit;
+
+-- name: GetRoomMessagesUnansweredFirst :many
+-- Unanswered messages first, newest first inside each group, starting after the cursor (answered, created_at, id)
+-- Ps: answered goes ASC and the rest DESC, so the cursor cannot be a single row comparison
+SELECT
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
+FROM messages
+WHERE
+    room_id = @room_id
+    AND "status" = 'approved'
+    AND (
+        NOT @has_cursor::BOOLEAN
+        OR "answered" > @cursor_answered::BOOLEAN
+        OR (
+            "answered" = @cursor_answered::BOOLEAN
+            AND ("created_at", "id") < (@cursor_created_at::TIMESTAMPTZ, @cursor_id::UUID)
+        )
+    )
+ORDER BY "answered" ASC, "created_at" DESC, "id" DESC
+LIMIT @page_limit;
+
+-- name: GetRoomPendingMessages :many
+-- Moderation queue, oldest first
 SELECT
-    "id", "room_id", "message", "reaction_count", "answered"
+    "id", "room_id", "message", "reaction_count", "answered", "created_at", "updated_at", "answered_at", "reply_count", "status"
 FROM messages
 WHERE
-    room_id = $1;
+    room_id = $1 AND "status" = 'pending'
+ORDER BY "created_at", "id";
+
+-- name: ModerateMessage :execrows
+-- Approve or reject a pending message (0 rows when it is not pending anymore)
+UPDATE messages
+SET
+    status = @status::VARCHAR,
+    updated_at = now()
+WHERE
+    id = @id AND "status" = 'pending';
 
 -- name: InsertMessage :one
 INSERT INTO messages
-    ( "room_id", "message" ) VALUES
-    ( $1, $2 )
+    ( "room_id", "message", "status" ) VALUES
+    ( $1, $2, $3 )
 RETURNING "id";
 
 -- name: ReactToMessage :one
+-- Add the reaction of a participant (changed is false when it was already there)
+WITH new_reaction AS (
+    INSERT INTO message_reactions
+        ( "message_id", "participant_id" ) VALUES
+        ( @message_id, @participant_id )
+    ON CONFLICT DO NOTHING
+    RETURNING "message_id"
+)
 UPDATE messages
 SET
-    reaction_count = reaction_count + 1
+    reaction_count = reaction_count + (SELECT COUNT(*) FROM new_reaction),
+    updated_at = CASE WHEN EXISTS (SELECT 1 FROM new_reaction) THEN now() ELSE updated_at END
 WHERE
-    id = $1
-RETURNING reaction_count;
+    id = @message_id
+RETURNING reaction_count, EXISTS (SELECT 1 FROM new_reaction) AS changed;
 
 -- name: RemoveReactionFromMessage :one
+-- Remove the reaction of a participant (changed is false when there was none)
+WITH removed_reaction AS (
+    DELETE FROM message_reactions
+    WHERE
+        message_id = @message_id AND participant_id = @participant_id
+    RETURNING "message_id"
+)
 UPDATE messages
 SET
-    reaction_count = reaction_count - 1
+    reaction_count = reaction_count - (SELECT COUNT(*) FROM removed_reaction),
+    updated_at = CASE WHEN EXISTS (SELECT 1 FROM removed_reaction) THEN now() ELSE updated_at END
+WHERE
+    id = @message_id
+RETURNING reaction_count, EXISTS (SELECT 1 FROM removed_reaction) AS changed;
+
+-- name: HasParticipantReacted :one
+SELECT EXISTS (
+    SELECT 1
+    FROM message_reactions
+    WHERE
+        message_id = $1 AND participant_id = $2
+);
+
+-- name: GetParticipantRoomReactions :many
+SELECT
+    r."message_id"
+FROM message_reactions r
+JOIN messages m ON m.id = r.message_id
+WHERE
+    m.room_id = $1 AND r.participant_id = $2;
+
+-- name: DeleteMessage :exec
+DELETE FROM messages
 WHERE
-    id = $1
-RETURNING reaction_count;
+    id = $1;
 
 -- name: MarkMessageAsAnswered :exec
+-- Ps: answering again keeps the first answered_at
 UPDATE messages
 SET
-    answered = true
+    answered = true,
+    answered_at = COALESCE(answered_at, now()),
+    updated_at = now()
+WHERE
+    id = $1;
+
+-- name: InsertRoomEvent :one
+WITH next_event AS (
+    UPDATE rooms
+    SET
+        last_event_seq = last_event_seq + 1
+    WHERE
+        id = @room_id
+    RETURNING last_event_seq
+)
+INSERT INTO room_events
+    ( "room_id", "seq", "kind", "payload" )
+SELECT
+    @room_id, last_event_seq, @kind::VARCHAR, @payload::JSONB
+FROM next_event
+RETURNING "seq";
+
+-- name: GetRoomEventsSince :many
+SELECT
+    "room_id", "seq", "kind", "payload"
+FROM room_events
+WHERE
+    room_id = $1 AND seq > $2
+ORDER BY seq;
+
+-- name: GetAnswer :one
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    id = $1;
+
+-- name: GetMessageAnswers :many
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    message_id = $1
+ORDER BY "created_at", "id";
+
+-- name: GetAnswersByMessageIDs :many
+-- Answers of a page of messages, in one round trip
+SELECT
+    "id", "message_id", "answer", "created_at", "updated_at"
+FROM answers
+WHERE
+    message_id = ANY(@message_ids::UUID[])
+ORDER BY "created_at", "id";
+
+-- name: InsertAnswer :one
+INSERT INTO answers
+    ( "message_id", "answer" ) VALUES
+    ( $1, $2 )
+RETURNING "id", "message_id", "answer", "created_at", "updated_at";
+
+-- name: UpdateAnswer :one
+UPDATE answers
+SET
+    answer = @answer,
+    updated_at = now()
+WHERE
+    id = @id
+RETURNING "id", "message_id", "answer", "created_at", "updated_at";
+
+-- name: DeleteAnswer :exec
+DELETE FROM answers
 WHERE
     id = $1;
+
+-- name: GetMessageReplies :many
+SELECT
+    "id", "message_id", "reply", "created_at"
+FROM replies
+WHERE
+    message_id = $1
+ORDER BY "created_at", "id";
+
+-- name: InsertReply :one
+-- Insert a reply and bump the reply count of its message (no row when the message does not exist)
+WITH parent AS (
+    UPDATE messages
+    SET
+        reply_count = reply_count + 1,
+        updated_at = now()
+    WHERE
+        id = @message_id
+    RETURNING "id", "reply_count"
+), new_reply AS (
+    INSERT INTO replies
+        ( "message_id", "reply" )
+    SELECT
+        id, @reply::VARCHAR
+    FROM parent
+    RETURNING "id", "message_id", "reply", "created_at"
+)
+SELECT
+    r."id", r."message_id", r."reply", r."created_at", p."reply_count"
+FROM new_reply r, parent p;
@@ -0,0 +1,39 @@
+package pgstore
+
+// Hand written (not generated by sqlc): schema version applied by tern
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// ExpectedSchemaVersion is the version tern reaches after the migrations shipped with this
+// binary (the number prefix of the last migration file)
+func ExpectedSchemaVersion() int32 {
+	files, _ := fs.Glob(migrations, "migrations/*.sql")
+
+	var version int32
+	for _, file := range files {
+		rawVersion, _, _ := strings.Cut(strings.TrimPrefix(file, "migrations/"), "_")
+		if fileVersion, err := strconv.ParseInt(rawVersion, 10, 32); err == nil && int32(fileVersion) > version {
+			version = int32(fileVersion)
+		}
+	}
+
+	return version
+}
+
+const getSchemaVersion = `SELECT version FROM schema_version`
+
+// SchemaVersion reads the version applied by tern (its default version table, see tern.conf)
+func SchemaVersion(ctx context.Context, db DBTX) (int32, error) {
+	var version int32
+	err := db.QueryRow(ctx, getSchemaVersion).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,90 @@
+package pgstore
+
+// Hand written (not generated by sqlc): one span per query
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+// QueryTracer starts a span for every query run on a connection (set it on pgx.ConnConfig.Tracer)
+// Ps1: sqlc queries are named after their "-- name:" header (e.g. "pgstore.InsertMessage"),
+// other statements after their first keyword (e.g. "LISTEN")
+// Ps2: arguments are never recorded (they hold participant text and secret hashes)
+// Ps3: queries run under WithRoomID carry wsrs.room_id
+type QueryTracer struct {
+	tracer trace.Tracer
+}
+
+// attrRoomID: same key as the api spans, so a room can be followed down to its queries
+const attrRoomID = attribute.Key("wsrs.room_id")
+
+// roomIDKey: context key of the room the queries run for
+type roomIDKey struct{}
+
+// WithRoomID tags the query spans run under ctx with roomID
+func WithRoomID(ctx context.Context, roomID string) context.Context {
+	return context.WithValue(ctx, roomIDKey{}, roomID)
+}
+
+func NewQueryTracer(provider trace.TracerProvider) *QueryTracer {
+	return &QueryTracer{tracer: provider.Tracer(tracerName)}
+}
+
+func (queryTracer *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name, operation := queryName(data.SQL)
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(data.SQL),
+	}
+	if roomID, ok := ctx.Value(roomIDKey{}).(string); ok {
+		attrs = append(attrs, attrRoomID.String(roomID))
+	}
+
+	ctx, _ = queryTracer.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx
+}
+
+func (queryTracer *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	// Ps: no rows is an expected outcome (404), not a failure
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+}
+
+// queryName: span name + operation of sql
+func queryName(sql string) (string, string) {
+	sql = strings.TrimSpace(sql)
+
+	// -- name: GetRoom :one
+	if header, ok := strings.CutPrefix(sql, "-- name:"); ok {
+		header, _, _ = strings.Cut(header, "\n")
+		if fields := strings.Fields(header); len(fields) > 0 {
+			return "pgstore." + fields[0], fields[0]
+		}
+	}
+
+	operation, _, _ := strings.Cut(sql, " ")
+	operation = strings.ToUpper(operation)
+	return operation, operation
+}
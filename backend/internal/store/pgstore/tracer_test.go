@@ -0,0 +1,71 @@
+package pgstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// runQuery traces sql as pgx would (no connection needed) and returns its span
+func runQuery(t *testing.T, ctx context.Context, sql string, err error) tracetest.SpanStub {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	tracer := pgstore.NewQueryTracer(provider)
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: err})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+
+	return spans[0]
+}
+
+func TestQueryTracer(t *testing.T) {
+	ctx := pgstore.WithRoomID(context.Background(), "room")
+	span := runQuery(t, ctx, "-- name: GetRoom :one\nSELECT * FROM rooms WHERE id = $1", pgx.ErrNoRows)
+
+	if span.Name != "pgstore.GetRoom" {
+		t.Fatalf("name = %q, want pgstore.GetRoom", span.Name)
+	}
+	found := false
+	for _, attr := range span.Attributes {
+		found = found || attr == attribute.String("wsrs.room_id", "room")
+	}
+	if !found {
+		t.Fatalf("no wsrs.room_id in %v", span.Attributes)
+	}
+	// Ps: no rows is not a failure
+	if span.Status.Code == codes.Error {
+		t.Fatalf("status = %+v", span.Status)
+	}
+}
+
+func TestQueryTracerStatement(t *testing.T) {
+	span := runQuery(t, context.Background(), "listen room_events", errors.New("connection lost"))
+
+	if span.Name != "LISTEN" {
+		t.Fatalf("name = %q, want LISTEN", span.Name)
+	}
+	for _, attr := range span.Attributes {
+		if attr.Key == "wsrs.room_id" {
+			t.Fatalf("unexpected wsrs.room_id outside a room: %v", attr)
+		}
+	}
+	if span.Status.Code != codes.Error {
+		t.Fatalf("status = %+v, want error", span.Status)
+	}
+}
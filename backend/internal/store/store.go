@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+
+	"github.com/alexandrecpedro/ama-room/backend/internal/store/pgstore"
+
+	"github.com/google/uuid"
+)
+
+// Store is the set of persistence operations used by the API handlers
+// Ps: the method set mirrors the queries generated by sqlc, so *pgstore.Queries
+// satisfies it directly and memstore.Store can replace it on tests and local demos
+type Store interface {
+	// (a) Rooms
+	GetRoom(ctx context.Context, id uuid.UUID) (pgstore.Room, error)
+	GetRoomsPage(ctx context.Context, arg pgstore.GetRoomsPageParams) ([]pgstore.Room, error)
+	InsertRoom(ctx context.Context, arg pgstore.InsertRoomParams) (uuid.UUID, error)
+	UpdateRoomStatus(ctx context.Context, arg pgstore.UpdateRoomStatusParams) (pgstore.Room, error)
+	UpdateRoomModeration(ctx context.Context, arg pgstore.UpdateRoomModerationParams) (pgstore.Room, error)
+
+	// (b) Messages
+	GetMessage(ctx context.Context, id uuid.UUID) (pgstore.Message, error)
+	// (b.0) Messages pages, one query per sort mode
+	GetRoomMessagesNewest(ctx context.Context, arg pgstore.GetRoomMessagesNewestParams) ([]pgstore.Message, error)
+	GetRoomMessagesMostReacted(ctx context.Context, arg pgstore.GetRoomMessagesMostReactedParams) ([]pgstore.Message, error)
+	GetRoomMessagesUnansweredFirst(ctx context.Context, arg pgstore.GetRoomMessagesUnansweredFirstParams) ([]pgstore.Message, error)
+	InsertMessage(ctx context.Context, arg pgstore.InsertMessageParams) (uuid.UUID, error)
+	MarkMessageAsAnswered(ctx context.Context, id uuid.UUID) error
+	DeleteMessage(ctx context.Context, id uuid.UUID) error
+	// (b.0.1) Moderation queue (pending messages of moderated rooms)
+	GetRoomPendingMessages(ctx context.Context, roomID uuid.UUID) ([]pgstore.Message, error)
+	ModerateMessage(ctx context.Context, arg pgstore.ModerateMessageParams) (int64, error)
+
+	// (b.1) Reactions (one per participant and message)
+	ReactToMessage(ctx context.Context, arg pgstore.ReactToMessageParams) (pgstore.ReactToMessageRow, error)
+	RemoveReactionFromMessage(ctx context.Context, arg pgstore.RemoveReactionFromMessageParams) (pgstore.RemoveReactionFromMessageRow, error)
+	HasParticipantReacted(ctx context.Context, arg pgstore.HasParticipantReactedParams) (bool, error)
+	GetParticipantRoomReactions(ctx context.Context, arg pgstore.GetParticipantRoomReactionsParams) ([]uuid.UUID, error)
+
+	// (b.2) Answers written by the host (one or more per message)
+	GetAnswer(ctx context.Context, id uuid.UUID) (pgstore.Answer, error)
+	GetMessageAnswers(ctx context.Context, messageID uuid.UUID) ([]pgstore.Answer, error)
+	GetAnswersByMessageIDs(ctx context.Context, messageIds []uuid.UUID) ([]pgstore.Answer, error)
+	InsertAnswer(ctx context.Context, arg pgstore.InsertAnswerParams) (pgstore.Answer, error)
+	UpdateAnswer(ctx context.Context, arg pgstore.UpdateAnswerParams) (pgstore.Answer, error)
+	DeleteAnswer(ctx context.Context, id uuid.UUID) error
+
+	// (b.3) Replies (follow-ups on a message)
+	GetMessageReplies(ctx context.Context, messageID uuid.UUID) ([]pgstore.Reply, error)
+	InsertReply(ctx context.Context, arg pgstore.InsertReplyParams) (pgstore.InsertReplyRow, error)
+
+	// (c) Room events (sequence numbers for resumable subscriptions)
+	InsertRoomEvent(ctx context.Context, arg pgstore.InsertRoomEventParams) (int64, error)
+	GetRoomEventsSince(ctx context.Context, arg pgstore.GetRoomEventsSinceParams) ([]pgstore.RoomEvent, error)
+}
+
+// Compile-time check: the sqlc queries must satisfy Store (memstore checks itself)
+var _ Store = (*pgstore.Queries)(nil)
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// TRACING
+// Installs the global OpenTelemetry tracer provider used by the api handlers (HTTP routes,
+// websocket commands, broadcasts) and by the pgstore query tracer
+// Ps1: the standard OTEL_* variables still apply: OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES,
+// OTEL_TRACES_SAMPLER(_ARG) and OTEL_EXPORTER_OTLP_(TRACES_)ENDPOINT / HEADERS / ...
+// Ps2: W3C trace context (traceparent) is propagated in and out
+
+// Exporters
+const (
+	// ExporterNone: spans are not recorded (default)
+	ExporterNone = "none"
+	// ExporterStdout: spans are printed as JSON on stdout (local debugging)
+	ExporterStdout = "stdout"
+	// ExporterOTLP: spans are sent with OTLP over HTTP (collector, Jaeger, Tempo...)
+	ExporterOTLP = "otlp"
+)
+
+// serviceName: service.name unless OTEL_SERVICE_NAME is set
+const serviceName = "wsrs"
+
+// Setup installs the tracer provider of exporter and returns its shutdown (flushes pending spans)
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q (expected %s, %s or %s)", exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Ps: later options win, so OTEL_SERVICE_NAME overrides the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}